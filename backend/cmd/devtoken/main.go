@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/kamdyns/movie-chat/internal/auth"
+)
+
+// devtoken mints a session token the server accepts when AUTH_PROVIDER=dev.
+// The secret is read from DEV_AUTH_SECRET, as the server does.
+func main() {
+	userID := flag.String("user", "", "user ID to put in the token's subject")
+	ttl := flag.Duration("ttl", 24*time.Hour, "how long the token is valid for")
+	roles := flag.String("roles", "", "comma separated roles to grant")
+	flag.Parse()
+
+	if *userID == "" {
+		log.Fatal("-user is required")
+	}
+
+	authenticator, err := auth.NewDevAuthenticator(os.Getenv("DEV_AUTH_SECRET"))
+	if err != nil {
+		log.Fatalf("Failed to create dev authenticator: %v", err)
+	}
+
+	var granted []string
+	if *roles != "" {
+		granted = strings.Split(*roles, ",")
+	}
+
+	token, err := authenticator.Mint(*userID, *ttl, granted...)
+	if err != nil {
+		log.Fatalf("Failed to mint token: %v", err)
+	}
+
+	fmt.Println(token)
+}
@@ -1,7 +1,11 @@
 package main
 
 import (
+	"context"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/kamdyns/movie-chat/internal/config"
 	"github.com/kamdyns/movie-chat/internal/server"
@@ -18,7 +22,13 @@ func main() {
 		log.Fatalf("Failed to create server: %v", err)
 	}
 
-	if err := srv.Run(); err != nil {
+	// The first SIGINT or SIGTERM starts a graceful shutdown. Once it has,
+	// the signals are no longer caught, so a second one kills the server.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	context.AfterFunc(ctx, stop)
+
+	if err := srv.Run(ctx); err != nil {
 		log.Fatalf("Failed to run server: %v", err)
 	}
 }
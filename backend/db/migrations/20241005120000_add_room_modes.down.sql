@@ -0,0 +1,4 @@
+ALTER TABLE rooms
+    DROP COLUMN IF EXISTS slow_mode_seconds,
+    DROP COLUMN IF EXISTS members_only,
+    DROP COLUMN IF EXISTS emoji_only;
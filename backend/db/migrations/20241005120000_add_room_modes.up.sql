@@ -0,0 +1,4 @@
+ALTER TABLE rooms
+    ADD COLUMN slow_mode_seconds INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN members_only BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN emoji_only BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,2 @@
+-- Room history is read by time, hiding messages from blocked users.
+CREATE INDEX IF NOT EXISTS idx_messages_room_id_created_at ON messages(room_id, created_at);
@@ -0,0 +1,6 @@
+ALTER TABLE users
+    ADD COLUMN display_name VARCHAR(50) NOT NULL DEFAULT '',
+    ADD COLUMN avatar_url TEXT NOT NULL DEFAULT '',
+    ADD COLUMN bio TEXT NOT NULL DEFAULT '',
+    ADD COLUMN favorite_genres TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN notification_preferences JSONB NOT NULL DEFAULT '{"room_starting": true, "mentions": true, "email": false}';
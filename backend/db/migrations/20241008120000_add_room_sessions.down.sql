@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS room_sessions;
+ALTER TABLE rooms DROP COLUMN IF EXISTS movie_title;
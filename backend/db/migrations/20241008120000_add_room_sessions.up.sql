@@ -0,0 +1,13 @@
+ALTER TABLE rooms ADD COLUMN movie_title TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE room_sessions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    room_id UUID NOT NULL,
+    user_id VARCHAR(255) NOT NULL,
+    joined_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    left_at TIMESTAMP WITH TIME ZONE,
+    FOREIGN KEY (room_id) REFERENCES rooms(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(clerk_user_id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_room_sessions_user_id_joined_at ON room_sessions(user_id, joined_at);
@@ -0,0 +1,2 @@
+-- The history endpoint reads a user's messages by time.
+CREATE INDEX IF NOT EXISTS idx_messages_user_id_created_at ON messages(user_id, created_at);
@@ -0,0 +1,17 @@
+CREATE TABLE webhook_events (
+    id VARCHAR(255) PRIMARY KEY,
+    type VARCHAR(100) NOT NULL,
+    processed_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE clerk_sessions (
+    id VARCHAR(255) PRIMARY KEY,
+    user_id VARCHAR(255) NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    ended_at TIMESTAMP WITH TIME ZONE,
+    FOREIGN KEY (user_id) REFERENCES users(clerk_user_id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_webhook_events_processed_at ON webhook_events(processed_at);
+CREATE INDEX idx_clerk_sessions_user_id ON clerk_sessions(user_id);
@@ -0,0 +1,13 @@
+ALTER TABLE users DROP COLUMN IF EXISTS deleted_at;
+
+-- Map the Clerk user IDs in created_by back to users.id. Rooms whose creator
+-- has no user row, such as rooms created before their creator's first
+-- webhook, cannot satisfy the foreign key and are deleted.
+DROP INDEX IF EXISTS idx_rooms_created_by;
+ALTER TABLE rooms ADD COLUMN created_by_id UUID;
+UPDATE rooms SET created_by_id = users.id FROM users WHERE users.clerk_user_id = rooms.created_by;
+DELETE FROM rooms WHERE created_by_id IS NULL;
+ALTER TABLE rooms DROP COLUMN created_by;
+ALTER TABLE rooms RENAME COLUMN created_by_id TO created_by;
+ALTER TABLE rooms ALTER COLUMN created_by SET NOT NULL;
+ALTER TABLE rooms ADD CONSTRAINT rooms_created_by_fkey FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE CASCADE;
@@ -0,0 +1,8 @@
+-- created_by has always been written with the Clerk user ID, so store it as
+-- one. Ownership is cleaned up by the account deletion policy instead of a
+-- cascading foreign key.
+ALTER TABLE rooms DROP CONSTRAINT IF EXISTS rooms_created_by_fkey;
+ALTER TABLE rooms ALTER COLUMN created_by TYPE VARCHAR(255);
+CREATE INDEX idx_rooms_created_by ON rooms(created_by);
+
+ALTER TABLE users ADD COLUMN deleted_at TIMESTAMP WITH TIME ZONE;
@@ -0,0 +1,5 @@
+ALTER TABLE rooms DROP COLUMN IF EXISTS closed_at;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS suspended_at,
+    DROP COLUMN IF EXISTS role;
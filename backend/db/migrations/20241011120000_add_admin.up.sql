@@ -0,0 +1,7 @@
+ALTER TABLE users
+    ADD COLUMN role VARCHAR(20) NOT NULL DEFAULT 'user',
+    ADD COLUMN suspended_at TIMESTAMP WITH TIME ZONE;
+
+-- closed_at is set when an admin force-closes a room. The room also expires
+-- at that moment, so it drops out of the public room list.
+ALTER TABLE rooms ADD COLUMN closed_at TIMESTAMP WITH TIME ZONE;
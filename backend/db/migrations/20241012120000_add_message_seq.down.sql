@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS backplane_sequences;
+
+DROP INDEX IF EXISTS messages_room_id_seq_idx;
+ALTER TABLE messages DROP COLUMN IF EXISTS seq;
@@ -0,0 +1,12 @@
+-- seq numbers a room's chat messages in the order they were delivered, so
+-- clients that reconnect can ask for what they missed. Messages sent before
+-- this migration have none.
+ALTER TABLE messages ADD COLUMN seq BIGINT;
+CREATE UNIQUE INDEX messages_room_id_seq_idx ON messages(room_id, seq) WHERE seq IS NOT NULL;
+
+-- backplane_sequences holds the last number handed out per room when the
+-- postgres backplane numbers messages.
+CREATE TABLE backplane_sequences (
+    name VARCHAR(255) PRIMARY KEY,
+    seq BIGINT NOT NULL
+);
@@ -0,0 +1,7 @@
+-- deleted_accounts remembers the Clerk user IDs of deleted accounts, so a
+-- token that is still valid, or a late webhook, does not bring the user
+-- back.
+CREATE TABLE deleted_accounts (
+    clerk_user_id VARCHAR(255) PRIMARY KEY,
+    deleted_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
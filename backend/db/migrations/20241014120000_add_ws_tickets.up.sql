@@ -0,0 +1,8 @@
+-- ws_tickets holds websocket tickets when instances share rooms through
+-- Postgres, so a ticket issued by one instance can be redeemed on another.
+CREATE TABLE ws_tickets (
+    id VARCHAR(64) PRIMARY KEY,
+    data BYTEA NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+CREATE INDEX ws_tickets_expires_at_idx ON ws_tickets(expires_at);
@@ -0,0 +1,90 @@
+package apperr
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	requestIDHeader = "X-Request-ID"
+	requestIDKey    = "requestID"
+	problemType     = "urn:movie-chat:problem:"
+)
+
+// Problem is an RFC 7807 problem details body. Code repeats the last part of
+// Type for clients that would rather not parse it.
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail"`
+	Instance  string       `json:"instance"`
+	Code      string       `json:"code"`
+	RequestID string       `json:"request_id"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+// RequestID tags every request with an ID, taken from the X-Request-ID
+// header when the caller sent one, and echoes it back.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestIDHeader)
+		if id == "" || len(id) > 128 {
+			id = uuid.NewString()
+		}
+		c.Set(requestIDKey, id)
+		c.Header(requestIDHeader, id)
+		c.Next()
+	}
+}
+
+// GetRequestID returns the ID RequestID gave the request.
+func GetRequestID(c *gin.Context) string {
+	return c.GetString(requestIDKey)
+}
+
+// Middleware writes the last error a handler recorded with c.Error as a
+// problem+json response. Handlers report failures by calling c.Error and
+// returning, and never write error bodies themselves.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+
+		e := From(c.Errors.Last().Err)
+		status := e.Kind.Status()
+		if status >= http.StatusInternalServerError {
+			log.Printf("request %s: %s %s: %v", GetRequestID(c), c.Request.Method, c.Request.URL.Path, c.Errors.Last().Err)
+		}
+		if e.RetryAfter > 0 {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(e.RetryAfter.Seconds()))))
+		}
+
+		c.Header("Content-Type", "application/problem+json")
+		c.AbortWithStatusJSON(status, &Problem{
+			Type:      problemType + e.Code,
+			Title:     http.StatusText(status),
+			Status:    status,
+			Detail:    e.Message,
+			Instance:  c.Request.URL.Path,
+			Code:      e.Code,
+			RequestID: GetRequestID(c),
+			Errors:    e.Fields,
+		})
+	}
+}
+
+// Abort records err for Middleware and stops the handler chain. It is for
+// middleware; handlers can simply call c.Error and return.
+func Abort(c *gin.Context, err error) {
+	c.Error(err)
+	c.Abort()
+}
@@ -0,0 +1,181 @@
+package apperr
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newTestRouter(err error) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(RequestID(), Middleware())
+	r.GET("/rooms/:id", func(c *gin.Context) {
+		c.Error(err)
+	})
+	return r
+}
+
+func serve(t *testing.T, r *gin.Engine, requestID string) (*httptest.ResponseRecorder, map[string]any) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/rooms/abc", nil)
+	if requestID != "" {
+		req.Header.Set(requestIDHeader, requestID)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var body map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("body %q: %v", w.Body.String(), err)
+	}
+	return w, body
+}
+
+func TestProblemBody(t *testing.T) {
+	err := Validation("invalid_request", "The request is invalid", FieldError{Field: "name", Message: "is required"})
+	w, body := serve(t, newTestRouter(err), "req-1")
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status %d, want 400", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/problem+json" {
+		t.Errorf("Content-Type %q, want application/problem+json", ct)
+	}
+	want := map[string]any{
+		"type":       "urn:movie-chat:problem:invalid_request",
+		"title":      "Bad Request",
+		"status":     float64(400),
+		"detail":     "The request is invalid",
+		"instance":   "/rooms/abc",
+		"code":       "invalid_request",
+		"request_id": "req-1",
+	}
+	for k, v := range want {
+		if body[k] != v {
+			t.Errorf("%s = %v, want %v", k, body[k], v)
+		}
+	}
+	fields, _ := body["errors"].([]any)
+	if len(fields) != 1 {
+		t.Fatalf("errors = %v, want one field error", body["errors"])
+	}
+	if f := fields[0].(map[string]any); f["field"] != "name" || f["message"] != "is required" {
+		t.Errorf("errors[0] = %v", f)
+	}
+}
+
+func TestProblemOmitsEmptyFieldErrors(t *testing.T) {
+	_, body := serve(t, newTestRouter(NotFound("room_not_found", "Room not found")), "")
+	if _, ok := body["errors"]; ok {
+		t.Errorf("errors = %v, want it left out", body["errors"])
+	}
+}
+
+func TestProblemCodes(t *testing.T) {
+	for _, tc := range []struct {
+		err    error
+		status int
+		code   string
+		detail string
+	}{
+		{NotFound("room_not_found", "Room not found"), http.StatusNotFound, "room_not_found", "Room not found"},
+		{Conflict("already_member", "Already a member"), http.StatusConflict, "already_member", "Already a member"},
+		{Unauthorized("unauthorized", "Sign in"), http.StatusUnauthorized, "unauthorized", "Sign in"},
+		{Forbidden("not_owner", "Not yours"), http.StatusForbidden, "not_owner", "Not yours"},
+		{Gone("room_closed", "Room closed"), http.StatusGone, "room_closed", "Room closed"},
+		{Unavailable("database_unavailable", "Try again", errors.New("down")), http.StatusServiceUnavailable, "database_unavailable", "Try again"},
+		// Errors that are not an *Error are internal, and their text
+		// never reaches the client.
+		{errors.New("pq: password authentication failed"), http.StatusInternalServerError, "internal_error", "Something went wrong"},
+		{Internal(errors.New("secret")), http.StatusInternalServerError, "internal_error", "Something went wrong"},
+	} {
+		w, body := serve(t, newTestRouter(tc.err), "")
+		if w.Code != tc.status || body["code"] != tc.code || body["detail"] != tc.detail {
+			t.Errorf("%v: got %d %v %q, want %d %s %q", tc.err, w.Code, body["code"], body["detail"], tc.status, tc.code, tc.detail)
+		}
+		if body["type"] != problemType+tc.code {
+			t.Errorf("%v: type %v, want %s", tc.err, body["type"], problemType+tc.code)
+		}
+	}
+}
+
+func TestProblemRetryAfter(t *testing.T) {
+	w, body := serve(t, newTestRouter(RateLimited("Slow down", 1500*time.Millisecond)), "")
+	if w.Code != http.StatusTooManyRequests || body["code"] != "rate_limited" {
+		t.Fatalf("got %d %v, want 429 rate_limited", w.Code, body["code"])
+	}
+	if got := w.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("Retry-After %q, want 2", got)
+	}
+}
+
+func TestRequestIDInBodyAndHeader(t *testing.T) {
+	r := newTestRouter(NotFound("room_not_found", "Room not found"))
+
+	w, body := serve(t, r, "from-client")
+	if got := w.Header().Get(requestIDHeader); got != "from-client" {
+		t.Errorf("header %q, want the caller's ID", got)
+	}
+	if body["request_id"] != "from-client" {
+		t.Errorf("request_id %v, want the caller's ID", body["request_id"])
+	}
+
+	w, body = serve(t, r, "")
+	id := w.Header().Get(requestIDHeader)
+	if id == "" {
+		t.Fatal("no request ID was generated")
+	}
+	if body["request_id"] != id {
+		t.Errorf("request_id %v, want the header's %q", body["request_id"], id)
+	}
+}
+
+func TestRequestIDReplacesOverlongIDs(t *testing.T) {
+	long := strings.Repeat("a", 129)
+	w, body := serve(t, newTestRouter(NotFound("room_not_found", "Room not found")), long)
+	id := w.Header().Get(requestIDHeader)
+	if id == "" || id == long {
+		t.Errorf("header %q, want a generated ID", id)
+	}
+	if body["request_id"] != id {
+		t.Errorf("request_id %v, want the header's %q", body["request_id"], id)
+	}
+}
+
+func TestMiddlewareLeavesWrittenResponses(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Middleware())
+	r.GET("/", func(c *gin.Context) {
+		c.String(http.StatusAccepted, "done")
+		c.Error(errors.New("logged only"))
+	})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusAccepted || w.Body.String() != "done" {
+		t.Errorf("got %d %q, want the handler's response", w.Code, w.Body.String())
+	}
+}
+
+func TestErrorsMatchByKindAndCode(t *testing.T) {
+	err := NotFound("room_not_found", "Room not found").Wrap(errors.New("cause"))
+	if !errors.Is(err, ErrNotFound) {
+		t.Error("a not found error does not match ErrNotFound")
+	}
+	if errors.Is(err, ErrConflict) {
+		t.Error("a not found error matches ErrConflict")
+	}
+	if !errors.Is(err, NotFound("room_not_found", "")) {
+		t.Error("errors with the same code do not match")
+	}
+	if errors.Is(err, NotFound("user_not_found", "")) {
+		t.Error("errors with different codes match")
+	}
+}
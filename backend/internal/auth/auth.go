@@ -0,0 +1,44 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+const (
+	ProviderClerk = "clerk"
+	ProviderJWKS  = "jwks"
+	ProviderDev   = "dev"
+)
+
+var ErrInvalidToken = errors.New("invalid token")
+
+// Identity is who a verified token says the caller is. OrgID and OrgRole
+// describe the organization active in the session, if any. Roles are
+// application roles granted through a custom "roles" claim.
+type Identity struct {
+	UserID    string
+	SessionID string
+	OrgID     string
+	OrgRole   string
+	Roles     []string
+	ExpiresAt time.Time
+}
+
+// HasRole reports whether the identity was granted role.
+func (i *Identity) HasRole(role string) bool {
+	for _, r := range i.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticator verifies a session token and returns the identity it
+// carries. Implementations return an error wrapping ErrInvalidToken for
+// tokens that are malformed, expired or wrongly signed.
+type Authenticator interface {
+	Authenticate(ctx context.Context, token string) (*Identity, error)
+}
@@ -0,0 +1,41 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/clerkinc/clerk-sdk-go/clerk"
+)
+
+type ClerkAuthenticator struct {
+	client clerk.Client
+}
+
+func NewClerkAuthenticator(client clerk.Client) *ClerkAuthenticator {
+	return &ClerkAuthenticator{client: client}
+}
+
+func (a *ClerkAuthenticator) Authenticate(ctx context.Context, token string) (*Identity, error) {
+	claims, err := a.client.VerifyToken(token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	identity := &Identity{
+		UserID:    claims.Subject,
+		SessionID: claims.SessionID,
+		OrgID:     claims.ActiveOrganizationID,
+		OrgRole:   claims.ActiveOrganizationRole,
+		ExpiresAt: claims.Expiry.Time(),
+	}
+
+	// The SDK drops custom claims, so roles added through a session token
+	// template are read from the payload Clerk has just verified. The
+	// template must map them from public metadata, which users cannot
+	// change; see the admin section of DOCUMENTATION.md.
+	if t, err := parseJWT(token); err == nil {
+		identity.Roles = t.claims.Roles
+	}
+
+	return identity, nil
+}
@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDevTokensRoundTrip(t *testing.T) {
+	a, err := NewDevAuthenticator("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := a.Mint("user_1", time.Hour, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	identity, err := a.Authenticate(context.Background(), token)
+	if err != nil {
+		t.Fatalf("Authenticate() = %v", err)
+	}
+	if identity.UserID != "user_1" || !identity.HasRole("admin") || !strings.HasPrefix(identity.SessionID, "sess_dev_") {
+		t.Fatalf("Authenticate() = %+v", identity)
+	}
+	if d := time.Until(identity.ExpiresAt); d < 59*time.Minute || d > time.Hour {
+		t.Fatalf("token expires in %s, want an hour", d)
+	}
+}
+
+// signDev signs header and claims with a's secret, however invalid they are.
+func signDev(a *DevAuthenticator, header, claims string) string {
+	unsigned := encodeJWT(header, claims, nil)
+	input := unsigned[:len(unsigned)-1]
+	return input + "." + base64.RawURLEncoding.EncodeToString(a.sign([]byte(input)))
+}
+
+func TestDevAuthenticatorRejects(t *testing.T) {
+	a, _ := NewDevAuthenticator("secret")
+	other, _ := NewDevAuthenticator("other secret")
+	expired, _ := a.Mint("user_1", -time.Minute)
+	fromOther, _ := other.Mint("user_1", time.Hour)
+	valid, _ := a.Mint("user_1", time.Hour)
+	parts := strings.Split(valid, ".")
+	admin := strings.Split(signDev(a, `{}`, `{"iss":"movie-chat-dev","sub":"admin","exp":9999999999}`), ".")[1]
+
+	for _, tc := range []struct {
+		name  string
+		token string
+	}{
+		{"malformed", "not a token"},
+		{"expired", expired},
+		{"signed with another secret", fromOther},
+		{"claims changed", parts[0] + "." + admin + "." + parts[2]},
+		{"unsigned", encodeJWT(`{"alg":"none"}`, `{"iss":"movie-chat-dev","sub":"user_1","exp":9999999999}`, nil)},
+		{"another algorithm", signDev(a, `{"alg":"HS512"}`, `{"iss":"movie-chat-dev","sub":"user_1","exp":9999999999}`)},
+		{"another issuer", signDev(a, `{"alg":"HS256"}`, `{"iss":"someone","sub":"user_1","exp":9999999999}`)},
+		{"no expiry", signDev(a, `{"alg":"HS256"}`, `{"iss":"movie-chat-dev","sub":"user_1"}`)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := a.Authenticate(context.Background(), tc.token); !errors.Is(err, ErrInvalidToken) {
+				t.Fatalf("Authenticate() = %v, want %v", err, ErrInvalidToken)
+			}
+		})
+	}
+	if _, err := a.Authenticate(context.Background(), signDev(a, `{"alg":"HS256"}`, `{"iss":"movie-chat-dev","sub":"user_1","exp":9999999999}`)); err != nil {
+		t.Fatalf("Authenticate() of a valid hand-made token = %v", err)
+	}
+}
+
+func TestDevAuthenticatorNeedsASecret(t *testing.T) {
+	if _, err := NewDevAuthenticator(""); err == nil {
+		t.Fatal("NewDevAuthenticator(\"\") succeeded")
+	}
+}
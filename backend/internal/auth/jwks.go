@@ -0,0 +1,254 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	jwksCacheTTL       = time.Hour
+	jwksMinRefreshWait = time.Minute
+)
+
+// JWKSAuthenticator verifies RS* and ES* signed JWTs against the keys
+// published by an OpenID Connect provider. If no JWKS URL is configured it
+// is discovered from the issuer's openid-configuration document.
+type JWKSAuthenticator struct {
+	issuer   string
+	audience string
+	jwksURL  string
+	client   *http.Client
+
+	mu          sync.Mutex
+	keys        map[string]crypto.PublicKey
+	fetchedAt   time.Time
+	lastAttempt time.Time
+}
+
+func NewJWKSAuthenticator(jwksURL, issuer, audience string) (*JWKSAuthenticator, error) {
+	if jwksURL == "" && issuer == "" {
+		return nil, errors.New("jwks auth needs a JWKS URL or an OIDC issuer")
+	}
+
+	return &JWKSAuthenticator{
+		issuer:   issuer,
+		audience: audience,
+		jwksURL:  jwksURL,
+		client:   &http.Client{Timeout: 5 * time.Second},
+	}, nil
+}
+
+func (a *JWKSAuthenticator) Authenticate(ctx context.Context, token string) (*Identity, error) {
+	t, err := parseJWT(token)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := a.key(ctx, t.header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(t, key); err != nil {
+		return nil, err
+	}
+	if err := t.claims.validate(time.Now(), a.issuer, a.audience); err != nil {
+		return nil, err
+	}
+
+	return t.claims.identity(), nil
+}
+
+// key returns the public key for kid, refetching the key set when it is
+// stale or does not know kid, which is how providers roll keys. Refetches
+// are spaced out so junk tokens cannot hammer the provider.
+func (a *JWKSAuthenticator) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	key, ok := a.keys[kid]
+	if ok && time.Since(a.fetchedAt) < jwksCacheTTL {
+		return key, nil
+	}
+
+	if time.Since(a.lastAttempt) >= jwksMinRefreshWait {
+		a.lastAttempt = time.Now()
+		keys, err := a.fetchKeys(ctx)
+		switch {
+		case err == nil:
+			a.keys = keys
+			a.fetchedAt = time.Now()
+			key, ok = keys[kid]
+		case !ok:
+			return nil, fmt.Errorf("failed to fetch signing keys: %w", err)
+		}
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown signing key %q", ErrInvalidToken, kid)
+	}
+	return key, nil
+}
+
+func (a *JWKSAuthenticator) fetchKeys(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	if a.jwksURL == "" {
+		var discovery struct {
+			JWKSURI string `json:"jwks_uri"`
+		}
+		configURL := strings.TrimSuffix(a.issuer, "/") + "/.well-known/openid-configuration"
+		if err := a.getJSON(ctx, configURL, &discovery); err != nil {
+			return nil, err
+		}
+		if discovery.JWKSURI == "" {
+			return nil, errors.New("openid configuration has no jwks_uri")
+		}
+		a.jwksURL = discovery.JWKSURI
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := a.getJSON(ctx, a.jwksURL, &set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	return keys, nil
+}
+
+func (a *JWKSAuthenticator) getJSON(ctx context.Context, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+func verifySignature(t *jwt, key crypto.PublicKey) error {
+	var hash crypto.Hash
+	switch t.header.Alg {
+	case "RS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512", "ES512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidToken, t.header.Alg)
+	}
+
+	h := hash.New()
+	h.Write(t.signingInput)
+	digest := h.Sum(nil)
+
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(t.header.Alg, "RS") {
+			break
+		}
+		if err := rsa.VerifyPKCS1v15(key, hash, digest, t.signature); err == nil {
+			return nil
+		}
+	case *ecdsa.PublicKey:
+		if !strings.HasPrefix(t.header.Alg, "ES") {
+			break
+		}
+		// JWS encodes ECDSA signatures as r||s, each padded to the key size.
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if len(t.signature) == 2*size {
+			r := new(big.Int).SetBytes(t.signature[:size])
+			s := new(big.Int).SetBytes(t.signature[size:])
+			if ecdsa.Verify(key, digest, r, s) {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("%w: bad signature", ErrInvalidToken)
+}
@@ -0,0 +1,218 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// keyServer is an OpenID provider publishing the public halves of its keys.
+type keyServer struct {
+	*httptest.Server
+	fetches atomic.Int32
+
+	mu   sync.Mutex
+	keys map[string]crypto.Signer
+}
+
+func newKeyServer(t *testing.T, keys map[string]crypto.Signer) *keyServer {
+	t.Helper()
+	s := &keyServer{keys: keys}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"jwks_uri": s.URL + "/keys"})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		s.fetches.Add(1)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		var set struct {
+			Keys []jwk `json:"keys"`
+		}
+		for kid, key := range s.keys {
+			set.Keys = append(set.Keys, publicJWK(kid, key.Public()))
+		}
+		json.NewEncoder(w).Encode(set)
+	})
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func publicJWK(kid string, key crypto.PublicKey) jwk {
+	enc := func(n *big.Int) string { return base64.RawURLEncoding.EncodeToString(n.Bytes()) }
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		return jwk{Kty: "RSA", Kid: kid, Use: "sig", N: enc(key.N), E: enc(big.NewInt(int64(key.E)))}
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		pad := func(n *big.Int) string { return base64.RawURLEncoding.EncodeToString(n.FillBytes(make([]byte, size))) }
+		return jwk{Kty: "EC", Kid: kid, Crv: key.Curve.Params().Name, X: pad(key.X), Y: pad(key.Y)}
+	}
+	panic("unsupported key")
+}
+
+// signJWT signs claims with key as alg would, using kid in the header.
+func signJWT(t *testing.T, alg, kid string, key crypto.Signer, claims map[string]any) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	unsigned := encodeJWT(string(header), string(payload), nil)
+	input := unsigned[:len(unsigned)-1]
+
+	hash := map[string]crypto.Hash{"256": crypto.SHA256, "384": crypto.SHA384, "512": crypto.SHA512}[alg[2:]]
+	h := hash.New()
+	h.Write([]byte(input))
+	digest := h.Sum(nil)
+
+	var sig []byte
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		var err error
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, key, hash, digest); err != nil {
+			t.Fatal(err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		size := (key.Curve.Params().BitSize + 7) / 8
+		sig = append(r.FillBytes(make([]byte, size)), s.FillBytes(make([]byte, size))...)
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func testKeys(t *testing.T) map[string]crypto.Signer {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p256, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	p384, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	return map[string]crypto.Signer{"rsa": rsaKey, "p256": p256, "p384": p384}
+}
+
+func validClaims(issuer string) map[string]any {
+	return map[string]any{
+		"iss":   issuer,
+		"sub":   "user_1",
+		"aud":   []string{"other", "movie-chat"},
+		"sid":   "sess_1",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"roles": []string{"admin"},
+	}
+}
+
+func TestJWKSAuthenticator(t *testing.T) {
+	keys := testKeys(t)
+	srv := newKeyServer(t, keys)
+	// Only the issuer is configured, so the key set is discovered.
+	a, err := NewJWKSAuthenticator("", srv.URL, "movie-chat")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		alg, kid string
+	}{
+		{"RS256", "rsa"},
+		{"RS512", "rsa"},
+		{"ES256", "p256"},
+		{"ES384", "p384"},
+	} {
+		t.Run(tc.alg, func(t *testing.T) {
+			token := signJWT(t, tc.alg, tc.kid, keys[tc.kid], validClaims(srv.URL))
+			identity, err := a.Authenticate(context.Background(), token)
+			if err != nil {
+				t.Fatalf("Authenticate() = %v", err)
+			}
+			if identity.UserID != "user_1" || identity.SessionID != "sess_1" || !identity.HasRole("admin") {
+				t.Fatalf("Authenticate() = %+v", identity)
+			}
+		})
+	}
+	if n := srv.fetches.Load(); n != 1 {
+		t.Fatalf("fetched the key set %d times, want once", n)
+	}
+}
+
+func TestJWKSAuthenticatorRejects(t *testing.T) {
+	keys := testKeys(t)
+	srv := newKeyServer(t, keys)
+	a, _ := NewJWKSAuthenticator(srv.URL+"/keys", srv.URL, "movie-chat")
+	stranger, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	claims := func(change func(map[string]any)) map[string]any {
+		c := validClaims(srv.URL)
+		change(c)
+		return c
+	}
+	for _, tc := range []struct {
+		name  string
+		token string
+	}{
+		{"unknown key", signJWT(t, "ES256", "missing", keys["p256"], validClaims(srv.URL))},
+		{"signed by another key", signJWT(t, "ES256", "p256", stranger, validClaims(srv.URL))},
+		{"algorithm for another key type", signJWT(t, "ES256", "rsa", keys["p256"], validClaims(srv.URL))},
+		{"unsupported algorithm", encodeJWT(`{"alg":"HS256","kid":"rsa"}`, `{"sub":"user_1"}`, []byte("sig"))},
+		{"unsigned", encodeJWT(`{"alg":"none","kid":"rsa"}`, `{"sub":"user_1"}`, nil)},
+		{"expired", signJWT(t, "RS256", "rsa", keys["rsa"], claims(func(c map[string]any) { c["exp"] = time.Now().Add(-time.Hour).Unix() }))},
+		{"not valid yet", signJWT(t, "RS256", "rsa", keys["rsa"], claims(func(c map[string]any) { c["nbf"] = time.Now().Add(time.Hour).Unix() }))},
+		{"wrong issuer", signJWT(t, "RS256", "rsa", keys["rsa"], claims(func(c map[string]any) { c["iss"] = "https://evil.example" }))},
+		{"wrong audience", signJWT(t, "RS256", "rsa", keys["rsa"], claims(func(c map[string]any) { c["aud"] = "other" }))},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := a.Authenticate(context.Background(), tc.token); !errors.Is(err, ErrInvalidToken) {
+				t.Fatalf("Authenticate() = %v, want %v", err, ErrInvalidToken)
+			}
+		})
+	}
+}
+
+// A token signed with a key the provider has just published makes the key
+// set be fetched again, but unknown keys cannot make it refetch every time.
+func TestJWKSAuthenticatorRefetchesForNewKeys(t *testing.T) {
+	keys := testKeys(t)
+	srv := newKeyServer(t, map[string]crypto.Signer{"rsa": keys["rsa"]})
+	a, _ := NewJWKSAuthenticator(srv.URL+"/keys", "", "")
+
+	if _, err := a.Authenticate(context.Background(), signJWT(t, "RS256", "rsa", keys["rsa"], validClaims(""))); err != nil {
+		t.Fatalf("Authenticate() = %v", err)
+	}
+
+	srv.mu.Lock()
+	srv.keys["p256"] = keys["p256"]
+	srv.mu.Unlock()
+	a.lastAttempt = time.Time{}
+	if _, err := a.Authenticate(context.Background(), signJWT(t, "ES256", "p256", keys["p256"], validClaims(""))); err != nil {
+		t.Fatalf("Authenticate() with a new key = %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		a.Authenticate(context.Background(), signJWT(t, "ES256", "missing", keys["p256"], validClaims("")))
+	}
+	if n := srv.fetches.Load(); n != 2 {
+		t.Fatalf("fetched the key set %d times, want twice", n)
+	}
+}
+
+func TestJWKSAuthenticatorNeedsAURLOrIssuer(t *testing.T) {
+	if _, err := NewJWKSAuthenticator("", "", "movie-chat"); err == nil {
+		t.Fatal("NewJWKSAuthenticator() succeeded without a JWKS URL or issuer")
+	}
+}
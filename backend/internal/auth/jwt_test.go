@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+// encodeJWT joins header, claims and signature the way tokens are sent.
+func encodeJWT(header, claims string, signature []byte) string {
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString([]byte(header)) + "." + enc.EncodeToString([]byte(claims)) + "." + enc.EncodeToString(signature)
+}
+
+func TestParseJWTRejectsMalformedTokens(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		token string
+	}{
+		{"empty", ""},
+		{"two parts", "a.b"},
+		{"four parts", "a.b.c.d"},
+		{"header not base64", "!!." + base64.RawURLEncoding.EncodeToString([]byte(`{}`)) + ".c2ln"},
+		{"header not JSON", encodeJWT(`nope`, `{}`, nil)},
+		{"claims not JSON", encodeJWT(`{"alg":"HS256"}`, `nope`, nil)},
+		{"aud not a string or array", encodeJWT(`{"alg":"HS256"}`, `{"aud":1}`, nil)},
+		{"signature not base64", encodeJWT(`{"alg":"HS256"}`, `{}`, nil) + "!!"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := parseJWT(tc.token); !errors.Is(err, ErrInvalidToken) {
+				t.Fatalf("parseJWT() = %v, want %v", err, ErrInvalidToken)
+			}
+		})
+	}
+}
+
+func TestParseJWTAudience(t *testing.T) {
+	for _, tc := range []struct {
+		aud  string
+		want []string
+	}{
+		{`"movie-chat"`, []string{"movie-chat"}},
+		{`["movie-chat","other"]`, []string{"movie-chat", "other"}},
+	} {
+		token, err := parseJWT(encodeJWT(`{"alg":"RS256","kid":"k1"}`, `{"sub":"user_1","aud":`+tc.aud+`}`, []byte("sig")))
+		if err != nil {
+			t.Fatalf("aud %s: parseJWT() = %v", tc.aud, err)
+		}
+		got, _ := json.Marshal(token.claims.Audience)
+		want, _ := json.Marshal(tc.want)
+		if string(got) != string(want) {
+			t.Fatalf("aud %s: parsed %s, want %s", tc.aud, got, want)
+		}
+		if token.header.Kid != "k1" || string(token.signature) != "sig" {
+			t.Fatalf("parsed header %+v and signature %q", token.header, token.signature)
+		}
+	}
+}
+
+func TestValidateClaims(t *testing.T) {
+	now := time.Now()
+	valid := jwtClaims{
+		Issuer:    "https://issuer.example",
+		Subject:   "user_1",
+		Audience:  audience{"other", "movie-chat"},
+		ExpiresAt: now.Add(time.Minute).Unix(),
+		NotBefore: now.Add(-time.Minute).Unix(),
+	}
+
+	for _, tc := range []struct {
+		name   string
+		change func(c *jwtClaims)
+		ok     bool
+	}{
+		{"valid", func(c *jwtClaims) {}, true},
+		{"missing subject", func(c *jwtClaims) { c.Subject = "" }, false},
+		{"no expiry", func(c *jwtClaims) { c.ExpiresAt = 0 }, false},
+		{"expired", func(c *jwtClaims) { c.ExpiresAt = now.Add(-time.Minute).Unix() }, false},
+		{"expired within leeway", func(c *jwtClaims) { c.ExpiresAt = now.Add(-leeway / 2).Unix() }, true},
+		{"not valid yet", func(c *jwtClaims) { c.NotBefore = now.Add(time.Minute).Unix() }, false},
+		{"not valid yet within leeway", func(c *jwtClaims) { c.NotBefore = now.Add(leeway / 2).Unix() }, true},
+		{"wrong issuer", func(c *jwtClaims) { c.Issuer = "https://evil.example" }, false},
+		{"wrong audience", func(c *jwtClaims) { c.Audience = audience{"other"} }, false},
+		{"no audience", func(c *jwtClaims) { c.Audience = nil }, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := valid
+			tc.change(&c)
+			err := c.validate(now, "https://issuer.example", "movie-chat")
+			if tc.ok && err != nil {
+				t.Fatalf("validate() = %v, want nil", err)
+			}
+			if !tc.ok && !errors.Is(err, ErrInvalidToken) {
+				t.Fatalf("validate() = %v, want %v", err, ErrInvalidToken)
+			}
+		})
+	}
+}
+
+func TestValidateClaimsSkipsEmptyIssuerAndAudience(t *testing.T) {
+	c := jwtClaims{Subject: "user_1", Issuer: "anyone", ExpiresAt: time.Now().Add(time.Minute).Unix()}
+	if err := c.validate(time.Now(), "", ""); err != nil {
+		t.Fatalf("validate() = %v, want nil", err)
+	}
+}
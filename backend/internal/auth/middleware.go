@@ -0,0 +1,161 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/kamdyns/movie-chat/internal/apperr"
+	"github.com/kamdyns/movie-chat/internal/model"
+)
+
+// TokenProtocol is the websocket subprotocol that marks the next offered
+// protocol as a session token, for clients that can neither set headers nor
+// fetch a ticket first: Sec-WebSocket-Protocol: access_token, <token>
+const TokenProtocol = "access_token"
+
+const (
+	identityKey = "identity"
+	userKey     = "user"
+)
+
+// UserLoader returns the local user for a verified user ID, creating it if
+// it does not exist yet.
+type UserLoader interface {
+	EnsureUser(ctx context.Context, clerkUserID string) (*model.User, error)
+}
+
+// Middleware rejects requests without a valid bearer token. It stores the
+// verified identity, read with GetIdentity, and the caller's user ID under
+// "userID". The local user is only loaded if a handler asks for it with
+// CurrentUser.
+func Middleware(a Authenticator, users UserLoader) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		if header == "" {
+			apperr.Abort(c, apperr.Unauthorized("missing_token", "No authorization header provided"))
+			return
+		}
+		sessionToken, ok := bearerToken(header)
+		if !ok {
+			apperr.Abort(c, apperr.Unauthorized("invalid_scheme", "Authorization header must use the Bearer scheme"))
+			return
+		}
+
+		identity, err := a.Authenticate(c.Request.Context(), sessionToken)
+		if err != nil {
+			apperr.Abort(c, apperr.Unauthorized("invalid_token", "Invalid session token"))
+			return
+		}
+
+		setIdentity(c, identity, users)
+		c.Next()
+	}
+}
+
+// WebSocketMiddleware authenticates a websocket handshake or event stream.
+// Browsers cannot set headers on either, so it accepts, in order, a ticket
+// from the "ticket" query parameter, a token offered via TokenProtocol, or
+// the usual Authorization header.
+func WebSocketMiddleware(a Authenticator, tickets *TicketStore, users UserLoader) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if t := c.Query("ticket"); t != "" {
+			identity, err := tickets.Redeem(c.Request.Context(), t)
+			if errors.Is(err, ErrInvalidTicket) {
+				apperr.Abort(c, apperr.Unauthorized("invalid_ticket", err.Error()))
+				return
+			}
+			if err != nil {
+				apperr.Abort(c, apperr.Unavailable("tickets_unavailable", "Tickets cannot be checked right now, please try again shortly", err))
+				return
+			}
+			setIdentity(c, identity, users)
+			c.Next()
+			return
+		}
+
+		sessionToken := protocolToken(websocket.Subprotocols(c.Request))
+		if sessionToken == "" {
+			sessionToken, _ = bearerToken(c.GetHeader("Authorization"))
+		}
+		if sessionToken == "" {
+			apperr.Abort(c, apperr.Unauthorized("missing_token", "No ticket or session token provided"))
+			return
+		}
+
+		identity, err := a.Authenticate(c.Request.Context(), sessionToken)
+		if err != nil {
+			apperr.Abort(c, apperr.Unauthorized("invalid_token", "Invalid session token"))
+			return
+		}
+
+		setIdentity(c, identity, users)
+		c.Next()
+	}
+}
+
+// GetIdentity returns the identity stored by the middleware, or nil on
+// routes that are not authenticated.
+func GetIdentity(c *gin.Context) *Identity {
+	v, _ := c.Get(identityKey)
+	identity, _ := v.(*Identity)
+	return identity
+}
+
+// CurrentUser returns the local user behind the request's identity. It is
+// loaded on first use and cached for the rest of the request.
+func CurrentUser(c *gin.Context) (*model.User, error) {
+	v, ok := c.Get(userKey)
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	return v.(*lazyUser).get(c.Request.Context())
+}
+
+type lazyUser struct {
+	once   sync.Once
+	users  UserLoader
+	userID string
+	user   *model.User
+	err    error
+}
+
+func (l *lazyUser) get(ctx context.Context) (*model.User, error) {
+	l.once.Do(func() {
+		l.user, l.err = l.users.EnsureUser(ctx, l.userID)
+	})
+	return l.user, l.err
+}
+
+func setIdentity(c *gin.Context, identity *Identity, users UserLoader) {
+	c.Set(identityKey, identity)
+	c.Set(userKey, &lazyUser{users: users, userID: identity.UserID})
+	c.Set("userID", identity.UserID)
+}
+
+// bearerToken takes the token out of an Authorization header. The scheme is
+// case-insensitive. A bare token is accepted too, as clients sent the
+// header that way before the scheme was required.
+func bearerToken(header string) (string, bool) {
+	scheme, token, found := strings.Cut(strings.TrimSpace(header), " ")
+	if !found {
+		return scheme, scheme != ""
+	}
+	if !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+func protocolToken(protocols []string) string {
+	for i, p := range protocols {
+		if p == TokenProtocol && i+1 < len(protocols) {
+			return protocols[i+1]
+		}
+	}
+	return ""
+}
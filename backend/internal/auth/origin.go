@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Origins is the set of browser origins allowed to call the API and open
+// websockets. CORS and the websocket upgrader share it, so the two cannot
+// drift apart.
+type Origins struct {
+	allowed map[string]bool
+}
+
+// NewOrigins refuses "*": CORS allows credentials, so allowing every origin
+// would let any site make requests and open websockets as the signed in
+// user.
+func NewOrigins(origins []string) (*Origins, error) {
+	o := &Origins{allowed: make(map[string]bool, len(origins))}
+	for _, origin := range origins {
+		if strings.TrimSpace(origin) == "*" {
+			return nil, errors.New(`ALLOWED_ORIGINS cannot contain "*" because credentialed requests are allowed; list the origins instead`)
+		}
+		o.allowed[normalizeOrigin(origin)] = true
+	}
+	return o, nil
+}
+
+// Allow reports whether origin is in the set.
+func (o *Origins) Allow(origin string) bool {
+	return o.allowed[normalizeOrigin(origin)]
+}
+
+// Check returns why a request's origin is not allowed, or nil if it is.
+// Requests without an Origin header do not come from a browser page, so
+// they are allowed.
+func (o *Origins) Check(r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("malformed origin %q", origin)
+	}
+	if !o.Allow(origin) {
+		return fmt.Errorf("origin %q is not in ALLOWED_ORIGINS", origin)
+	}
+	return nil
+}
+
+// normalizeOrigin lets configured origins differ from the Origin header in
+// case or a trailing slash.
+func normalizeOrigin(origin string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(origin)), "/")
+}
@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOriginsCheck(t *testing.T) {
+	o, err := NewOrigins([]string{"https://Movies.example.com/", " http://localhost:3000 "})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		origin string
+		ok     bool
+	}{
+		{"", true},
+		{"https://movies.example.com", true},
+		{"https://MOVIES.example.com", true},
+		{"https://movies.example.com/", true},
+		{"http://localhost:3000", true},
+		{"http://movies.example.com", false},
+		{"https://movies.example.com:8443", false},
+		{"https://evil.example.com", false},
+		{"http://localhost:3001", false},
+		{"null", false},
+		{"movies.example.com", false},
+		{"https://", false},
+		{"://movies.example.com", false},
+	} {
+		r := httptest.NewRequest("GET", "/ws", nil)
+		if tc.origin != "" {
+			r.Header.Set("Origin", tc.origin)
+		}
+		if err := o.Check(r); (err == nil) != tc.ok {
+			t.Errorf("Check(%q) = %v, want allowed %v", tc.origin, err, tc.ok)
+		}
+	}
+}
+
+func TestOriginsRefuseWildcard(t *testing.T) {
+	for _, origins := range [][]string{{"*"}, {"http://localhost:3000", " * "}} {
+		if _, err := NewOrigins(origins); err == nil {
+			t.Errorf("NewOrigins(%q) allowed a wildcard", origins)
+		}
+	}
+}
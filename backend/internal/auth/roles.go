@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/kamdyns/movie-chat/internal/apperr"
+	"github.com/kamdyns/movie-chat/internal/model"
+)
+
+// RequireActive rejects suspended users. It loads the caller's user, so it
+// must run after Middleware or WebSocketMiddleware.
+func RequireActive() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := CurrentUser(c)
+		if err != nil {
+			apperr.Abort(c, err)
+			return
+		}
+		if user.SuspendedAt != nil {
+			apperr.Abort(c, apperr.Forbidden("account_suspended", "Your account is suspended"))
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireAdmin only lets platform admins through. The role can come from
+// the token's roles claim, for identity providers that manage it, or from
+// the user's role column, which admins set through the admin API.
+func RequireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		identity := GetIdentity(c)
+		if identity != nil && identity.HasRole(model.RoleAdmin) {
+			c.Next()
+			return
+		}
+
+		user, err := CurrentUser(c)
+		if err != nil {
+			apperr.Abort(c, err)
+			return
+		}
+		if user.Role != model.RoleAdmin {
+			apperr.Abort(c, apperr.Forbidden("admin_required", "Admin access required"))
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrInvalidTicket = errors.New("invalid or expired ticket")
+
+type ticket struct {
+	Identity  *Identity `json:"identity"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// TicketBackend keeps issued tickets until they are redeemed. Take removes
+// and returns a ticket in one step, so each ticket is redeemed at most once
+// however many instances share the backend.
+type TicketBackend interface {
+	Put(ctx context.Context, id string, data []byte, expiresAt time.Time) error
+	Take(ctx context.Context, id string) ([]byte, error)
+}
+
+// TicketStore hands out short-lived, single-use tickets that stand in for a
+// session token where a header cannot be set, such as a browser's websocket
+// handshake. Instances behind a load balancer must share a backend, or a
+// ticket issued by one is rejected by the others.
+type TicketStore struct {
+	ttl     time.Duration
+	backend TicketBackend
+}
+
+func NewTicketStore(ttl time.Duration, backend TicketBackend) *TicketStore {
+	return &TicketStore{ttl: ttl, backend: backend}
+}
+
+// Issue returns a new ticket for identity and when it stops being accepted.
+func (s *TicketStore) Issue(ctx context.Context, identity *Identity) (string, time.Time, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", time.Time{}, err
+	}
+	id := base64.RawURLEncoding.EncodeToString(b)
+	expiresAt := time.Now().Add(s.ttl)
+
+	data, err := json.Marshal(ticket{Identity: identity, ExpiresAt: expiresAt})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if err := s.backend.Put(ctx, id, data, expiresAt); err != nil {
+		return "", time.Time{}, err
+	}
+	return id, expiresAt, nil
+}
+
+// Redeem returns the identity a ticket was issued for. A ticket can only be
+// redeemed once, whether or not the connection using it succeeds.
+func (s *TicketStore) Redeem(ctx context.Context, id string) (*Identity, error) {
+	data, err := s.backend.Take(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var t ticket
+	if err := json.Unmarshal(data, &t); err != nil || time.Now().After(t.ExpiresAt) {
+		return nil, ErrInvalidTicket
+	}
+	return t.Identity, nil
+}
+
+type memoryTicket struct {
+	data      []byte
+	expiresAt time.Time
+}
+
+// MemoryTickets keeps tickets in this instance's memory, which is enough
+// for a single instance.
+type MemoryTickets struct {
+	mu      sync.Mutex
+	tickets map[string]memoryTicket
+}
+
+func NewMemoryTickets() *MemoryTickets {
+	return &MemoryTickets{tickets: make(map[string]memoryTicket)}
+}
+
+func (m *MemoryTickets) Put(ctx context.Context, id string, data []byte, expiresAt time.Time) error {
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for k, t := range m.tickets {
+		if now.After(t.expiresAt) {
+			delete(m.tickets, k)
+		}
+	}
+	m.tickets[id] = memoryTicket{data: data, expiresAt: expiresAt}
+	return nil
+}
+
+func (m *MemoryTickets) Take(ctx context.Context, id string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.tickets[id]
+	if !ok {
+		return nil, ErrInvalidTicket
+	}
+	delete(m.tickets, id)
+	return t.data, nil
+}
@@ -0,0 +1,37 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// PostgresTickets shares tickets between instances through the ws_tickets
+// table, for deployments that already share rooms through Postgres.
+type PostgresTickets struct {
+	db *sql.DB
+}
+
+func NewPostgresTickets(db *sql.DB) *PostgresTickets {
+	return &PostgresTickets{db: db}
+}
+
+// Put stores a ticket and clears out expired ones, which are never taken
+// when a client gives up before connecting.
+func (p *PostgresTickets) Put(ctx context.Context, id string, data []byte, expiresAt time.Time) error {
+	if _, err := p.db.ExecContext(ctx, `DELETE FROM ws_tickets WHERE expires_at < NOW()`); err != nil {
+		return err
+	}
+	_, err := p.db.ExecContext(ctx, `INSERT INTO ws_tickets(id, data, expires_at) VALUES ($1, $2, $3)`, id, data, expiresAt)
+	return err
+}
+
+func (p *PostgresTickets) Take(ctx context.Context, id string) ([]byte, error) {
+	var data []byte
+	err := p.db.QueryRowContext(ctx, `DELETE FROM ws_tickets WHERE id = $1 RETURNING data`, id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidTicket
+	}
+	return data, err
+}
@@ -0,0 +1,34 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisTicketPrefix namespaces ticket keys, alongside the backplane's keys.
+const redisTicketPrefix = "movie-chat:ticket:"
+
+// RedisTickets shares tickets between instances as Redis keys that expire
+// on their own.
+type RedisTickets struct {
+	client *redis.Client
+}
+
+func NewRedisTickets(client *redis.Client) *RedisTickets {
+	return &RedisTickets{client: client}
+}
+
+func (r *RedisTickets) Put(ctx context.Context, id string, data []byte, expiresAt time.Time) error {
+	return r.client.Set(ctx, redisTicketPrefix+id, data, time.Until(expiresAt)).Err()
+}
+
+func (r *RedisTickets) Take(ctx context.Context, id string) ([]byte, error) {
+	data, err := r.client.GetDel(ctx, redisTicketPrefix+id).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrInvalidTicket
+	}
+	return data, err
+}
@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestTicketsAreSingleUse(t *testing.T) {
+	ctx := context.Background()
+	store := NewTicketStore(time.Minute, NewMemoryTickets())
+
+	id, _, err := store.Issue(ctx, &Identity{UserID: "user_1", SessionID: "sess_1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	identity, err := store.Redeem(ctx, id)
+	if err != nil {
+		t.Fatalf("Redeem() = %v", err)
+	}
+	if identity.UserID != "user_1" || identity.SessionID != "sess_1" {
+		t.Fatalf("Redeem() = %+v", identity)
+	}
+	if _, err := store.Redeem(ctx, id); !errors.Is(err, ErrInvalidTicket) {
+		t.Fatalf("second Redeem() = %v, want %v", err, ErrInvalidTicket)
+	}
+}
+
+func TestTicketsExpire(t *testing.T) {
+	ctx := context.Background()
+	store := NewTicketStore(time.Millisecond, NewMemoryTickets())
+
+	id, _, err := store.Issue(ctx, &Identity{UserID: "user_1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	if _, err := store.Redeem(ctx, id); !errors.Is(err, ErrInvalidTicket) {
+		t.Fatalf("Redeem() = %v, want %v", err, ErrInvalidTicket)
+	}
+}
+
+func TestRedisTicketsAreSharedBetweenInstances(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	newStore := func() *TicketStore {
+		client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+		t.Cleanup(func() { client.Close() })
+		return NewTicketStore(time.Minute, NewRedisTickets(client))
+	}
+	a, b := newStore(), newStore()
+
+	id, _, err := a.Issue(ctx, &Identity{UserID: "user_1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	identity, err := b.Redeem(ctx, id)
+	if err != nil || identity.UserID != "user_1" {
+		t.Fatalf("Redeem() on another instance = %+v, %v", identity, err)
+	}
+	if _, err := a.Redeem(ctx, id); !errors.Is(err, ErrInvalidTicket) {
+		t.Fatalf("Redeem() after another instance redeemed = %v, want %v", err, ErrInvalidTicket)
+	}
+}
@@ -0,0 +1,102 @@
+// Package backplane carries events between server instances so that users
+// connected to different instances can share a room.
+package backplane
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	ProviderLocal    = "local"
+	ProviderPostgres = "postgres"
+	ProviderRedis    = "redis"
+)
+
+var ErrPayloadTooLarge = errors.New("backplane: payload too large")
+
+// Message is a payload published on a channel. Seq is its number in the
+// sequence it was published with, or zero if it was published without one.
+type Message struct {
+	Channel string
+	Seq     int64
+	Payload []byte
+}
+
+// Backplane is a pub/sub bus shared by every instance. Payloads published
+// to a channel are delivered to every instance subscribed to it, the
+// publisher included, in the same order on every instance.
+type Backplane interface {
+	Publish(ctx context.Context, channel string, payload []byte) error
+	// PublishSequenced numbers payload with the next value of the sequence
+	// named key and publishes it, as one step, so payloads of a sequence
+	// are always delivered in increasing order. It returns the number.
+	PublishSequenced(ctx context.Context, channel, key string, payload []byte) (int64, error)
+	Subscribe(ctx context.Context, channel string) error
+	Unsubscribe(ctx context.Context, channel string) error
+	// Messages delivers payloads for the subscribed channels. It is closed
+	// by Close.
+	Messages() <-chan Message
+	Close() error
+}
+
+// Seed returns the number a sequence has reached, for sequences that may
+// have been numbered before the backplane last saw them, such as after a
+// restart. Sequences start from zero without one.
+type Seed func(ctx context.Context, key string) (int64, error)
+
+// seeder runs a Seed once per sequence.
+type seeder struct {
+	seed Seed
+
+	mu     sync.Mutex
+	seeded map[string]bool
+}
+
+func newSeeder(seed Seed) *seeder {
+	return &seeder{seed: seed, seeded: make(map[string]bool)}
+}
+
+// ensure calls apply with the seed for key the first time key is used.
+func (s *seeder) ensure(ctx context.Context, key string, apply func(int64) error) error {
+	if s.seed == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.seeded[key] {
+		return nil
+	}
+	n, err := s.seed(ctx, key)
+	if err != nil {
+		return err
+	}
+	if err := apply(n); err != nil {
+		return err
+	}
+	s.seeded[key] = true
+	return nil
+}
+
+// frame and unframe carry a sequence number alongside the payload for
+// transports whose messages are a single string.
+func frame(seq int64, payload []byte) string {
+	return strconv.FormatInt(seq, 10) + ":" + string(payload)
+}
+
+func unframe(channel, data string) (Message, bool) {
+	n, payload, ok := strings.Cut(data, ":")
+	if !ok {
+		return Message{}, false
+	}
+	seq, err := strconv.ParseInt(n, 10, 64)
+	if err != nil {
+		return Message{}, false
+	}
+	return Message{Channel: channel, Seq: seq, Payload: []byte(payload)}, true
+}
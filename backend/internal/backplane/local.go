@@ -0,0 +1,116 @@
+package backplane
+
+import (
+	"context"
+	"sync"
+)
+
+// Local is a backplane for a single instance. It hands payloads straight
+// back to the publisher.
+type Local struct {
+	mu       sync.RWMutex
+	subs     map[string]bool
+	closed   bool
+	messages chan Message
+	// done is closed by Close, and sending counts the payloads being
+	// handed over, which Close waits for before closing messages.
+	done    chan struct{}
+	sending sync.WaitGroup
+
+	// seqMu is held from numbering a payload until it is queued, so
+	// payloads are queued in sequence order.
+	seqMu  sync.Mutex
+	seqs   map[string]int64
+	seeder *seeder
+}
+
+func NewLocal(seed Seed) *Local {
+	return &Local{
+		subs:     make(map[string]bool),
+		messages: make(chan Message, 256),
+		done:     make(chan struct{}),
+		seqs:     make(map[string]int64),
+		seeder:   newSeeder(seed),
+	}
+}
+
+func (l *Local) Publish(ctx context.Context, channel string, payload []byte) error {
+	return l.publish(ctx, Message{Channel: channel, Payload: payload})
+}
+
+func (l *Local) PublishSequenced(ctx context.Context, channel, key string, payload []byte) (int64, error) {
+	l.seqMu.Lock()
+	defer l.seqMu.Unlock()
+
+	err := l.seeder.ensure(ctx, key, func(n int64) error {
+		l.seqs[key] = max(l.seqs[key], n)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	seq := l.seqs[key] + 1
+	if err := l.publish(ctx, Message{Channel: channel, Seq: seq, Payload: payload}); err != nil {
+		return 0, err
+	}
+	l.seqs[key] = seq
+	return seq, nil
+}
+
+// publish queues m, waiting while the queue is full. The lock is only held
+// to check the subscription, so a full queue does not hold up Subscribe.
+func (l *Local) publish(ctx context.Context, m Message) error {
+	l.mu.RLock()
+	if l.closed || !l.subs[m.Channel] {
+		l.mu.RUnlock()
+		return nil
+	}
+	l.sending.Add(1)
+	l.mu.RUnlock()
+	defer l.sending.Done()
+
+	select {
+	case l.messages <- m:
+		return nil
+	case <-l.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *Local) Subscribe(ctx context.Context, channel string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.subs[channel] = true
+	return nil
+}
+
+func (l *Local) Unsubscribe(ctx context.Context, channel string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.subs, channel)
+	return nil
+}
+
+func (l *Local) Messages() <-chan Message {
+	return l.messages
+}
+
+func (l *Local) Close() error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil
+	}
+	l.closed = true
+	close(l.done)
+	l.mu.Unlock()
+
+	l.sending.Wait()
+	close(l.messages)
+	return nil
+}
@@ -0,0 +1,124 @@
+package backplane
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// receive waits for the next message from b.
+func receive(t *testing.T, b Backplane) Message {
+	t.Helper()
+	select {
+	case m, ok := <-b.Messages():
+		if !ok {
+			t.Fatal("Messages() closed")
+		}
+		return m
+	case <-time.After(2 * time.Second):
+		t.Fatal("no message received")
+	}
+	return Message{}
+}
+
+// expectNone fails if b delivers anything within a short while.
+func expectNone(t *testing.T, b Backplane) {
+	t.Helper()
+	select {
+	case m := <-b.Messages():
+		t.Fatalf("unexpected message %+v", m)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestLocalDeliversSubscribedChannels(t *testing.T) {
+	ctx := context.Background()
+	l := NewLocal(nil)
+	defer l.Close()
+
+	l.Subscribe(ctx, "room:1")
+	l.Publish(ctx, "room:2", []byte("elsewhere"))
+	l.Publish(ctx, "room:1", []byte("hello"))
+	if m := receive(t, l); m.Channel != "room:1" || string(m.Payload) != "hello" {
+		t.Fatalf("got %+v", m)
+	}
+
+	l.Unsubscribe(ctx, "room:1")
+	l.Publish(ctx, "room:1", []byte("gone"))
+	expectNone(t, l)
+}
+
+func TestLocalSequencesStartFromSeed(t *testing.T) {
+	ctx := context.Background()
+	seeds := 0
+	l := NewLocal(func(ctx context.Context, key string) (int64, error) {
+		seeds++
+		return 41, nil
+	})
+	defer l.Close()
+	l.Subscribe(ctx, "room:1")
+
+	for want := int64(42); want <= 44; want++ {
+		seq, err := l.PublishSequenced(ctx, "room:1", "room:1", []byte("m"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m := receive(t, l); seq != want || m.Seq != want {
+			t.Fatalf("published %d, received %d, want %d", seq, m.Seq, want)
+		}
+	}
+	if seeds != 1 {
+		t.Fatalf("seeded %d times, want once", seeds)
+	}
+}
+
+// A publisher waiting on a full queue must not hold up subscribing, as the
+// Hub subscribes rooms while its backplane messages back up, and Close must
+// release it.
+func TestLocalFullQueueDoesNotBlockSubscribeOrClose(t *testing.T) {
+	ctx := context.Background()
+	l := NewLocal(nil)
+	l.Subscribe(ctx, "room:1")
+	for i := 0; i < cap(l.messages); i++ {
+		l.Publish(ctx, "room:1", []byte("m"))
+	}
+
+	published := make(chan error)
+	go func() { published <- l.Publish(ctx, "room:1", []byte("waiting")) }()
+
+	subscribed := make(chan struct{})
+	go func() {
+		l.Subscribe(ctx, "room:2")
+		close(subscribed)
+	}()
+	select {
+	case <-subscribed:
+	case <-time.After(time.Second):
+		t.Fatal("Subscribe() waited for the full queue")
+	}
+
+	l.Close()
+	select {
+	case err := <-published:
+		if err != nil {
+			t.Fatalf("Publish() = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Close() did not release the waiting publisher")
+	}
+}
+
+func TestLocalPublishGivesUpWithContext(t *testing.T) {
+	l := NewLocal(nil)
+	defer l.Close()
+	l.Subscribe(context.Background(), "room:1")
+	for i := 0; i < cap(l.messages); i++ {
+		l.Publish(context.Background(), "room:1", []byte("m"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := l.Publish(ctx, "room:1", []byte("late")); err != context.DeadlineExceeded {
+		t.Fatalf("Publish() = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
@@ -0,0 +1,165 @@
+package backplane
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// maxNotifyPayload is the largest payload NOTIFY accepts in a default
+// Postgres build.
+const maxNotifyPayload = 8000
+
+// Postgres is a backplane built on LISTEN/NOTIFY, so instances that already
+// share a database need nothing else. Postgres delivers notifications in
+// commit order, which is the same on every listener.
+//
+// Sequences are rows of backplane_sequences. Numbering a payload locks its
+// row until the notification is committed, so notifications of a sequence
+// are committed, and delivered, in order.
+//
+// Notifications sent while the listening connection is down are lost. The
+// listener reconnects on its own and logs the gap.
+type Postgres struct {
+	db       *sql.DB
+	listener *pq.Listener
+	messages chan Message
+	seeder   *seeder
+}
+
+// NewPostgres publishes through db and listens on a dedicated connection
+// opened with connString.
+func NewPostgres(db *sql.DB, connString string, seed Seed) *Postgres {
+	p := &Postgres{
+		db:       db,
+		messages: make(chan Message, 256),
+		seeder:   newSeeder(seed),
+	}
+	p.listener = pq.NewListener(connString, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		switch ev {
+		case pq.ListenerEventDisconnected:
+			log.Printf("backplane: postgres listener disconnected: %v", err)
+		case pq.ListenerEventReconnected:
+			log.Printf("backplane: postgres listener reconnected, notifications may have been missed")
+		case pq.ListenerEventConnectionAttemptFailed:
+			log.Printf("backplane: postgres listener failed to connect: %v", err)
+		}
+	})
+	go p.receive()
+	return p
+}
+
+func (p *Postgres) Publish(ctx context.Context, channel string, payload []byte) error {
+	data := frame(0, payload)
+	if len(data) >= maxNotifyPayload {
+		return ErrPayloadTooLarge
+	}
+	_, err := p.db.ExecContext(ctx, `SELECT pg_notify($1, $2)`, channel, data)
+	return err
+}
+
+func (p *Postgres) PublishSequenced(ctx context.Context, channel, key string, payload []byte) (int64, error) {
+	err := p.seeder.ensure(ctx, key, func(n int64) error {
+		query := `
+			INSERT INTO backplane_sequences(name, seq) VALUES ($1, $2)
+			ON CONFLICT (name) DO UPDATE SET seq = GREATEST(backplane_sequences.seq, $2)
+		`
+		_, err := p.db.ExecContext(ctx, query, key, n)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO backplane_sequences(name, seq) VALUES ($1, 1)
+		ON CONFLICT (name) DO UPDATE SET seq = backplane_sequences.seq + 1
+		RETURNING seq
+	`
+	var seq int64
+	if err := tx.QueryRowContext(ctx, query, key).Scan(&seq); err != nil {
+		return 0, err
+	}
+
+	data := frame(seq, payload)
+	if len(data) >= maxNotifyPayload {
+		return 0, ErrPayloadTooLarge
+	}
+	if _, err := tx.ExecContext(ctx, `SELECT pg_notify($1, $2)`, channel, data); err != nil {
+		return 0, err
+	}
+	return seq, tx.Commit()
+}
+
+// Subscribe and Unsubscribe wait for the listening connection, which may be
+// reconnecting. They give up when ctx expires, but the change is still made
+// once the connection is back.
+func (p *Postgres) Subscribe(ctx context.Context, channel string) error {
+	return withContext(ctx, func() error {
+		err := p.listener.Listen(channel)
+		if errors.Is(err, pq.ErrChannelAlreadyOpen) {
+			return nil
+		}
+		return err
+	})
+}
+
+func (p *Postgres) Unsubscribe(ctx context.Context, channel string) error {
+	return withContext(ctx, func() error {
+		err := p.listener.Unlisten(channel)
+		if errors.Is(err, pq.ErrChannelNotOpen) {
+			return nil
+		}
+		return err
+	})
+}
+
+func (p *Postgres) Messages() <-chan Message {
+	return p.messages
+}
+
+func (p *Postgres) Close() error {
+	return p.listener.Close()
+}
+
+// receive forwards notifications until the listener is closed. pq sends a
+// nil notification after reconnecting, which carries nothing to forward.
+func (p *Postgres) receive() {
+	defer close(p.messages)
+
+	for n := range p.listener.Notify {
+		if n == nil {
+			continue
+		}
+		m, ok := unframe(n.Channel, n.Extra)
+		if !ok {
+			log.Printf("backplane: malformed notification on %s", n.Channel)
+			continue
+		}
+		p.messages <- m
+	}
+}
+
+// withContext runs f, which cannot be cancelled, and returns its error, or
+// ctx's if ctx expires first. f carries on in the background.
+func withContext(ctx context.Context, f func() error) error {
+	errc := make(chan error, 1)
+	go func() { errc <- f() }()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,107 @@
+package backplane
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisPrefix namespaces channels and keys so the Redis server can be
+// shared.
+const redisPrefix = "movie-chat:"
+
+// publishSequenced numbers and publishes a payload in one script, which
+// Redis runs without interleaving anything else.
+var publishSequenced = redis.NewScript(`
+local seq = redis.call('INCR', KEYS[1])
+redis.call('PUBLISH', KEYS[2], seq .. ':' .. ARGV[1])
+return seq
+`)
+
+// Redis is a backplane built on Redis pub/sub. It only uses PUBLISH and
+// SUBSCRIBE, so any server that speaks the Redis protocol works, including
+// Valkey, KeyDB and in-memory stand-ins such as miniredis for local runs.
+// Redis delivers a channel's messages in publish order to every subscriber.
+// Sequences are counters under redisPrefix + "seq:".
+type Redis struct {
+	client   *redis.Client
+	pubsub   *redis.PubSub
+	messages chan Message
+	seeder   *seeder
+}
+
+// NewRedis connects to the server at url, e.g. redis://localhost:6379/0.
+func NewRedis(ctx context.Context, url string, seed Seed) (*Redis, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+
+	client := redis.NewClient(opts)
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	r := &Redis{
+		client:   client,
+		pubsub:   client.Subscribe(ctx),
+		messages: make(chan Message, 256),
+		seeder:   newSeeder(seed),
+	}
+	go r.receive()
+	return r, nil
+}
+
+func (r *Redis) Publish(ctx context.Context, channel string, payload []byte) error {
+	return r.client.Publish(ctx, redisPrefix+channel, frame(0, payload)).Err()
+}
+
+func (r *Redis) PublishSequenced(ctx context.Context, channel, key string, payload []byte) (int64, error) {
+	seqKey := redisPrefix + "seq:" + key
+	err := r.seeder.ensure(ctx, key, func(n int64) error {
+		return r.client.SetNX(ctx, seqKey, n, 0).Err()
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return publishSequenced.Run(ctx, r.client, []string{seqKey, redisPrefix + channel}, payload).Int64()
+}
+
+func (r *Redis) Subscribe(ctx context.Context, channel string) error {
+	return r.pubsub.Subscribe(ctx, redisPrefix+channel)
+}
+
+func (r *Redis) Unsubscribe(ctx context.Context, channel string) error {
+	return r.pubsub.Unsubscribe(ctx, redisPrefix+channel)
+}
+
+func (r *Redis) Messages() <-chan Message {
+	return r.messages
+}
+
+func (r *Redis) Close() error {
+	err := r.pubsub.Close()
+	if cerr := r.client.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// receive forwards messages until the subscription is closed. go-redis
+// resubscribes by itself after reconnecting.
+func (r *Redis) receive() {
+	defer close(r.messages)
+
+	for m := range r.pubsub.Channel() {
+		msg, ok := unframe(strings.TrimPrefix(m.Channel, redisPrefix), m.Payload)
+		if !ok {
+			log.Printf("backplane: malformed message on %s", m.Channel)
+			continue
+		}
+		r.messages <- msg
+	}
+}
@@ -0,0 +1,100 @@
+package backplane
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func newTestRedis(t *testing.T, mr *miniredis.Miniredis, seed Seed) *Redis {
+	t.Helper()
+	r, err := NewRedis(context.Background(), "redis://"+mr.Addr(), seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.Close() })
+	return r
+}
+
+// waitForSubscribers waits until the server counts want subscribers to
+// channel, as go-redis does not wait for subscriptions to be confirmed.
+func waitForSubscribers(t *testing.T, mr *miniredis.Miniredis, channel string, want int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for mr.PubSubNumSub(redisPrefix + channel)[redisPrefix+channel] != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("%s never had %d subscribers", channel, want)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func subscribe(t *testing.T, mr *miniredis.Miniredis, r *Redis, channel string, want int) {
+	t.Helper()
+	if err := r.Subscribe(context.Background(), channel); err != nil {
+		t.Fatal(err)
+	}
+	waitForSubscribers(t, mr, channel, want)
+}
+
+func TestRedisDeliversToEveryInstance(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	a := newTestRedis(t, mr, nil)
+	b := newTestRedis(t, mr, nil)
+	subscribe(t, mr, a, "room:1", 1)
+	subscribe(t, mr, b, "room:1", 2)
+
+	if err := a.Publish(ctx, "room:1", []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range []*Redis{a, b} {
+		if m := receive(t, r); m.Channel != "room:1" || m.Seq != 0 || string(m.Payload) != "hello" {
+			t.Fatalf("got %+v", m)
+		}
+	}
+
+	if err := b.Unsubscribe(ctx, "room:1"); err != nil {
+		t.Fatal(err)
+	}
+	waitForSubscribers(t, mr, "room:1", 1)
+	a.Publish(ctx, "room:1", []byte("after"))
+	receive(t, a)
+	expectNone(t, b)
+}
+
+func TestRedisSequencesAreShared(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	seed := func(ctx context.Context, key string) (int64, error) { return 10, nil }
+	a := newTestRedis(t, mr, seed)
+	b := newTestRedis(t, mr, seed)
+	subscribe(t, mr, a, "room:1", 1)
+
+	for i, r := range []*Redis{a, b, a} {
+		seq, err := r.PublishSequenced(ctx, "room:1", "room:1", []byte("m"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := int64(11 + i)
+		if m := receive(t, a); seq != want || m.Seq != want {
+			t.Fatalf("published %d, received %d, want %d", seq, m.Seq, want)
+		}
+	}
+}
+
+func TestRedisClosesMessages(t *testing.T) {
+	r := newTestRedis(t, miniredis.RunT(t), nil)
+	r.Close()
+
+	select {
+	case _, ok := <-r.Messages():
+		if ok {
+			t.Fatal("message received after Close")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Messages() not closed")
+	}
+}
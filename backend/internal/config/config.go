@@ -2,6 +2,9 @@ package config
 
 import (
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -10,6 +13,64 @@ type Config struct {
 	ServerAddress  string
 	ClerkSecretKey string
 	ClerkPublicKey string
+	AllowedOrigins []string
+
+	AuthProvider  string
+	JWKSURL       string
+	OIDCIssuer    string
+	OIDCAudience  string
+	DevAuthSecret string
+	WSTicketTTL   time.Duration
+	WSExpiryGrace time.Duration
+
+	ClerkWebhookSecret string
+	WebhookTolerance   time.Duration
+	UserDeletionPolicy string
+
+	MaxMessageLength   int
+	BlockedWords       []string
+	BlockedWordAction  string
+	LinkPolicy         string
+	AllowedLinkDomains []string
+	DeniedLinkDomains  []string
+	DuplicateWindow    time.Duration
+	DuplicateLimit     int
+
+	WSMessageRate    float64
+	WSMessageBurst   int
+	WSMaxViolations  int
+	RoomMessageRate  float64
+	RoomMessageBurst int
+	APIRequestRate   float64
+	APIRequestBurst  int
+	CreateRoomRate   float64
+	CreateRoomBurst  int
+
+	RoomMinLifetime time.Duration
+	RoomMaxLifetime time.Duration
+
+	Backplane string
+	RedisURL  string
+
+	HubShards          int
+	WSSendBuffer       int
+	SlowConsumerPolicy string
+	SlowConsumerDrops  int
+	WSReplayBuffer     int
+	WSIdleRoomTimeout  time.Duration
+
+	WSPingInterval   time.Duration
+	WSPongWait       time.Duration
+	WSWriteWait      time.Duration
+	WSMaxMessageSize int
+
+	WSReadBufferSize       int
+	WSWriteBufferSize      int
+	WSCompression          bool
+	WSCompressionThreshold int
+
+	ShutdownTimeout   time.Duration
+	WSReconnectJitter time.Duration
 }
 
 func Load() (*Config, error) {
@@ -21,5 +82,122 @@ func Load() (*Config, error) {
 		ServerAddress:  os.Getenv("SERVER_ADDRESS"),
 		ClerkSecretKey: os.Getenv("CLERK_SECRET_KEY"),
 		ClerkPublicKey: os.Getenv("CLERK_PUBLIC_KEY"),
+		AllowedOrigins: getEnvListOr("ALLOWED_ORIGINS", "http://localhost:3000"),
+
+		AuthProvider:  getEnv("AUTH_PROVIDER", "clerk"),
+		JWKSURL:       os.Getenv("JWKS_URL"),
+		OIDCIssuer:    os.Getenv("OIDC_ISSUER"),
+		OIDCAudience:  os.Getenv("OIDC_AUDIENCE"),
+		DevAuthSecret: os.Getenv("DEV_AUTH_SECRET"),
+		WSTicketTTL:   getEnvDuration("WS_TICKET_TTL", 30*time.Second),
+		WSExpiryGrace: getEnvDuration("WS_EXPIRY_GRACE", 10*time.Second),
+
+		ClerkWebhookSecret: os.Getenv("CLERK_WEBHOOK_SECRET"),
+		WebhookTolerance:   getEnvDuration("WEBHOOK_TOLERANCE", 5*time.Minute),
+		UserDeletionPolicy: getEnv("USER_DELETION_POLICY", "anonymize"),
+
+		MaxMessageLength:   getEnvInt("MAX_MESSAGE_LENGTH", 500),
+		BlockedWords:       getEnvList("BLOCKED_WORDS"),
+		BlockedWordAction:  getEnv("BLOCKED_WORD_ACTION", "mask"),
+		LinkPolicy:         getEnv("LINK_POLICY", "allow"),
+		AllowedLinkDomains: getEnvList("ALLOWED_LINK_DOMAINS"),
+		DeniedLinkDomains:  getEnvList("DENIED_LINK_DOMAINS"),
+		DuplicateWindow:    getEnvDuration("DUPLICATE_WINDOW", 30*time.Second),
+		DuplicateLimit:     getEnvInt("DUPLICATE_LIMIT", 3),
+
+		WSMessageRate:    getEnvFloat("WS_MESSAGE_RATE", 2),
+		WSMessageBurst:   getEnvInt("WS_MESSAGE_BURST", 5),
+		WSMaxViolations:  getEnvInt("WS_MAX_VIOLATIONS", 10),
+		RoomMessageRate:  getEnvFloat("ROOM_MESSAGE_RATE", 50),
+		RoomMessageBurst: getEnvInt("ROOM_MESSAGE_BURST", 100),
+		APIRequestRate:   getEnvFloat("API_REQUEST_RATE", 5),
+		APIRequestBurst:  getEnvInt("API_REQUEST_BURST", 20),
+		CreateRoomRate:   getEnvFloat("CREATE_ROOM_RATE", 0.1),
+		CreateRoomBurst:  getEnvInt("CREATE_ROOM_BURST", 3),
+
+		RoomMinLifetime: getEnvDuration("ROOM_MIN_LIFETIME", 5*time.Minute),
+		RoomMaxLifetime: getEnvDuration("ROOM_MAX_LIFETIME", 72*time.Hour),
+
+		Backplane: getEnv("BACKPLANE", "local"),
+		RedisURL:  getEnv("REDIS_URL", "redis://localhost:6379/0"),
+
+		HubShards:          getEnvInt("HUB_SHARDS", 0),
+		WSSendBuffer:       getEnvInt("WS_SEND_BUFFER", 64),
+		SlowConsumerPolicy: getEnv("SLOW_CONSUMER_POLICY", "drop"),
+		SlowConsumerDrops:  getEnvInt("SLOW_CONSUMER_MAX_DROPPED", 32),
+		WSReplayBuffer:     getEnvInt("WS_REPLAY_BUFFER", 256),
+		WSIdleRoomTimeout:  getEnvDuration("WS_IDLE_ROOM_TIMEOUT", 30*time.Second),
+
+		WSPingInterval:   getEnvDuration("WS_PING_INTERVAL", 30*time.Second),
+		WSPongWait:       getEnvDuration("WS_PONG_WAIT", 60*time.Second),
+		WSWriteWait:      getEnvDuration("WS_WRITE_WAIT", 10*time.Second),
+		WSMaxMessageSize: getEnvInt("WS_MAX_MESSAGE_SIZE", 8192),
+
+		WSReadBufferSize:       getEnvInt("WS_READ_BUFFER_SIZE", 1024),
+		WSWriteBufferSize:      getEnvInt("WS_WRITE_BUFFER_SIZE", 1024),
+		WSCompression:          getEnvBool("WS_COMPRESSION", true),
+		WSCompressionThreshold: getEnvInt("WS_COMPRESSION_THRESHOLD", 512),
+
+		ShutdownTimeout:   getEnvDuration("SHUTDOWN_TIMEOUT", 30*time.Second),
+		WSReconnectJitter: getEnvDuration("WS_RECONNECT_JITTER", 5*time.Second),
 	}, nil
 }
+
+func getEnv(key, fallback string) string {
+	if v, ok := os.LookupEnv(key); ok && v != "" {
+		return v
+	}
+	return fallback
+}
+
+func getEnvInt(key string, fallback int) int {
+	v, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return v
+}
+
+func getEnvFloat(key string, fallback float64) float64 {
+	v, err := strconv.ParseFloat(os.Getenv(key), 64)
+	if err != nil {
+		return fallback
+	}
+	return v
+}
+
+func getEnvBool(key string, fallback bool) bool {
+	v, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return v
+}
+
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	v, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return v
+}
+
+// getEnvList splits a comma separated variable, dropping empty entries.
+func getEnvList(key string) []string {
+	var list []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// getEnvListOr is getEnvList, falling back to fallback when the variable
+// lists nothing.
+func getEnvListOr(key string, fallback ...string) []string {
+	if list := getEnvList(key); len(list) > 0 {
+		return list
+	}
+	return fallback
+}
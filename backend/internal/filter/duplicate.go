@@ -0,0 +1,72 @@
+package filter
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// DuplicateFilter rejects a user who repeats the same message in a room more
+// than limit times within window.
+type DuplicateFilter struct {
+	window time.Duration
+	limit  int
+
+	mu     sync.Mutex
+	recent map[string]*recentMessage
+}
+
+type recentMessage struct {
+	content string
+	count   int
+	lastAt  time.Time
+}
+
+func NewDuplicateFilter(window time.Duration, limit int) *DuplicateFilter {
+	return &DuplicateFilter{
+		window: window,
+		limit:  limit,
+		recent: make(map[string]*recentMessage),
+	}
+}
+
+func (f *DuplicateFilter) Apply(msg *Message) Result {
+	if f.limit <= 0 || f.window <= 0 {
+		return allow(msg)
+	}
+
+	key := msg.RoomID + ":" + msg.UserID
+	content := strings.ToLower(strings.Join(strings.Fields(msg.Content), " "))
+	now := time.Now()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.prune(now)
+
+	r, ok := f.recent[key]
+	if !ok || r.content != content || now.Sub(r.lastAt) > f.window {
+		f.recent[key] = &recentMessage{content: content, count: 1, lastAt: now}
+		return allow(msg)
+	}
+
+	r.lastAt = now
+	if r.count >= f.limit {
+		return reject("Please don't repeat the same message")
+	}
+	r.count++
+	return allow(msg)
+}
+
+// prune drops entries that have aged out of the window so the map does not
+// grow with every user that has ever chatted. Must be called with mu held.
+func (f *DuplicateFilter) prune(now time.Time) {
+	if len(f.recent) < 1024 {
+		return
+	}
+	for key, r := range f.recent {
+		if now.Sub(r.lastAt) > f.window {
+			delete(f.recent, key)
+		}
+	}
+}
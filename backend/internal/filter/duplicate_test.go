@@ -0,0 +1,59 @@
+package filter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDuplicateFilter(t *testing.T) {
+	f := NewDuplicateFilter(time.Minute, 2)
+	send := func(user, room, content string) Result {
+		return f.Apply(&Message{UserID: user, RoomID: room, Content: content})
+	}
+
+	for i := 0; i < 2; i++ {
+		if got := send("u1", "r1", "hello"); got != (Result{Action: Allow, Content: "hello"}) {
+			t.Fatalf("repeat %d: Apply() = %+v, want allow", i, got)
+		}
+	}
+	// Case and spacing do not make a message new.
+	if got := send("u1", "r1", "  HELLO "); got.Action != Reject {
+		t.Fatalf("Apply() = %+v, want a rejected repeat", got)
+	}
+	if got := send("u2", "r1", "hello"); got.Action != Allow {
+		t.Fatalf("another user: Apply() = %+v, want allow", got)
+	}
+	if got := send("u1", "r2", "hello"); got.Action != Allow {
+		t.Fatalf("another room: Apply() = %+v, want allow", got)
+	}
+	if got := send("u1", "r1", "something else"); got.Action != Allow {
+		t.Fatalf("new content: Apply() = %+v, want allow", got)
+	}
+	if got := send("u1", "r1", "hello"); got.Action != Allow {
+		t.Fatalf("after other content: Apply() = %+v, want allow", got)
+	}
+}
+
+func TestDuplicateFilterForgetsAfterWindow(t *testing.T) {
+	f := NewDuplicateFilter(10*time.Millisecond, 1)
+	msg := &Message{UserID: "u1", RoomID: "r1", Content: "hello"}
+
+	f.Apply(msg)
+	if got := f.Apply(msg); got.Action != Reject {
+		t.Fatalf("Apply() = %+v, want a rejected repeat", got)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if got := f.Apply(msg); got.Action != Allow {
+		t.Fatalf("Apply() = %+v, want allow once the window passed", got)
+	}
+}
+
+func TestDuplicateFilterDisabled(t *testing.T) {
+	f := NewDuplicateFilter(time.Minute, 0)
+	msg := &Message{UserID: "u1", RoomID: "r1", Content: "hello"}
+	for i := 0; i < 5; i++ {
+		if got := f.Apply(msg); got.Action != Allow {
+			t.Fatalf("repeat %d: Apply() = %+v, want allow", i, got)
+		}
+	}
+}
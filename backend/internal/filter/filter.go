@@ -0,0 +1,72 @@
+package filter
+
+type Action int
+
+const (
+	Allow Action = iota
+	Rewrite
+	Reject
+)
+
+// Message is the part of a chat message the filters get to inspect.
+type Message struct {
+	UserID  string
+	RoomID  string
+	Content string
+}
+
+type Result struct {
+	Action  Action
+	Content string
+	Reason  string
+}
+
+type Filter interface {
+	Apply(msg *Message) Result
+}
+
+func allow(msg *Message) Result {
+	return Result{Action: Allow, Content: msg.Content}
+}
+
+func rewrite(content string) Result {
+	return Result{Action: Rewrite, Content: content}
+}
+
+func reject(reason string) Result {
+	return Result{Action: Reject, Reason: reason}
+}
+
+type Chain struct {
+	filters []Filter
+}
+
+func NewChain(filters ...Filter) *Chain {
+	return &Chain{filters: filters}
+}
+
+// Run passes msg through every filter in order. A rewrite replaces the
+// content seen by the filters after it, and the first rejection stops the
+// chain.
+func (c *Chain) Run(msg *Message) Result {
+	if c == nil {
+		return allow(msg)
+	}
+
+	rewritten := false
+	for _, f := range c.filters {
+		res := f.Apply(msg)
+		switch res.Action {
+		case Reject:
+			return res
+		case Rewrite:
+			msg.Content = res.Content
+			rewritten = true
+		}
+	}
+
+	if rewritten {
+		return rewrite(msg.Content)
+	}
+	return allow(msg)
+}
@@ -0,0 +1,59 @@
+package filter
+
+import "testing"
+
+// funcFilter is a Filter that records being applied.
+type funcFilter struct {
+	apply   func(msg *Message) Result
+	applied int
+}
+
+func (f *funcFilter) Apply(msg *Message) Result {
+	f.applied++
+	return f.apply(msg)
+}
+
+func TestChainAllows(t *testing.T) {
+	c := NewChain(NewMaxLength(10), NewWordFilter([]string{"darn"}, WordActionMask))
+	if got := c.Run(&Message{Content: "hello"}); got != (Result{Action: Allow, Content: "hello"}) {
+		t.Fatalf("Run() = %+v, want allow", got)
+	}
+}
+
+func TestChainPassesRewritesOn(t *testing.T) {
+	var seen string
+	last := &funcFilter{apply: func(msg *Message) Result {
+		seen = msg.Content
+		return allow(msg)
+	}}
+	c := NewChain(NewWordFilter([]string{"darn"}, WordActionMask), last)
+
+	got := c.Run(&Message{Content: "darn it"})
+	if got != (Result{Action: Rewrite, Content: "**** it"}) {
+		t.Fatalf("Run() = %+v, want the masked content", got)
+	}
+	if seen != "**** it" {
+		t.Fatalf("the next filter saw %q, want the rewritten content", seen)
+	}
+}
+
+func TestChainStopsAtFirstReject(t *testing.T) {
+	first := &funcFilter{apply: func(*Message) Result { return reject("first") }}
+	second := &funcFilter{apply: func(*Message) Result { return reject("second") }}
+	c := NewChain(NewWordFilter([]string{"darn"}, WordActionMask), first, second)
+
+	got := c.Run(&Message{Content: "darn"})
+	if got != (Result{Action: Reject, Reason: "first"}) {
+		t.Fatalf("Run() = %+v, want the first rejection", got)
+	}
+	if second.applied != 0 {
+		t.Fatal("a filter ran after the message was rejected")
+	}
+}
+
+func TestNilChainAllows(t *testing.T) {
+	var c *Chain
+	if got := c.Run(&Message{Content: "hello"}); got.Action != Allow || got.Content != "hello" {
+		t.Fatalf("Run() = %+v, want allow", got)
+	}
+}
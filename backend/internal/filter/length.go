@@ -0,0 +1,21 @@
+package filter
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+type MaxLength struct {
+	max int
+}
+
+func NewMaxLength(max int) *MaxLength {
+	return &MaxLength{max: max}
+}
+
+func (f *MaxLength) Apply(msg *Message) Result {
+	if f.max > 0 && utf8.RuneCountInString(msg.Content) > f.max {
+		return reject(fmt.Sprintf("Message is longer than %d characters", f.max))
+	}
+	return allow(msg)
+}
@@ -0,0 +1,28 @@
+package filter
+
+import "testing"
+
+func TestMaxLength(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		max     int
+		content string
+		want    Action
+	}{
+		{"short", 5, "hello", Allow},
+		{"counts characters, not bytes", 5, "héllö", Allow},
+		{"too long", 5, "hello!", Reject},
+		{"disabled", 0, "hello!", Allow},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := NewMaxLength(tc.max).Apply(&Message{Content: tc.content})
+			if got.Action != tc.want {
+				t.Fatalf("Apply(%q) = %+v, want action %d", tc.content, got, tc.want)
+			}
+			// Length is never fixed by truncating the message.
+			if got.Action == Allow && got.Content != tc.content {
+				t.Fatalf("Apply(%q) changed the content to %q", tc.content, got.Content)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package filter
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const (
+	LinkPolicyAllow     = "allow"
+	LinkPolicyDeny      = "deny"
+	LinkPolicyAllowlist = "allowlist"
+)
+
+var linkPattern = regexp.MustCompile(`(?i)\b(?:https?://|www\.)[^\s<>"]+`)
+
+// LinkPolicy decides which links may be posted. Under LinkPolicyAllow only
+// denied domains are rejected, under LinkPolicyAllowlist only allowed domains
+// pass, and LinkPolicyDeny rejects every link. A domain also covers its
+// subdomains.
+type LinkPolicy struct {
+	mode    string
+	allowed []string
+	denied  []string
+}
+
+func NewLinkPolicy(mode string, allowed, denied []string) *LinkPolicy {
+	return &LinkPolicy{
+		mode:    mode,
+		allowed: normalizeDomains(allowed),
+		denied:  normalizeDomains(denied),
+	}
+}
+
+func (f *LinkPolicy) Apply(msg *Message) Result {
+	for _, link := range linkPattern.FindAllString(msg.Content, -1) {
+		host := linkHost(link)
+
+		switch {
+		case f.mode == LinkPolicyDeny:
+			return reject("Links are not allowed in this chat")
+		case matchesDomain(host, f.denied):
+			return reject("Links to " + host + " are not allowed")
+		case f.mode == LinkPolicyAllowlist && !matchesDomain(host, f.allowed):
+			return reject("Links to " + host + " are not allowed")
+		}
+	}
+	return allow(msg)
+}
+
+func linkHost(link string) string {
+	if !strings.Contains(link, "://") {
+		link = "http://" + link
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+func matchesDomain(host string, domains []string) bool {
+	for _, d := range domains {
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeDomains(domains []string) []string {
+	out := make([]string, 0, len(domains))
+	for _, d := range domains {
+		d = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(d)), "www.")
+		if d != "" {
+			out = append(out, d)
+		}
+	}
+	return out
+}
@@ -0,0 +1,55 @@
+package filter
+
+import "testing"
+
+func TestLinkPolicy(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		policy  *LinkPolicy
+		content string
+		want    Result
+	}{
+		{
+			name:    "no links",
+			policy:  NewLinkPolicy(LinkPolicyDeny, nil, nil),
+			content: "no links here",
+			want:    Result{Action: Allow, Content: "no links here"},
+		},
+		{
+			name:    "allowed",
+			policy:  NewLinkPolicy(LinkPolicyAllow, nil, []string{"spam.example"}),
+			content: "see https://example.com/film",
+			want:    Result{Action: Allow, Content: "see https://example.com/film"},
+		},
+		{
+			name:    "denied subdomain",
+			policy:  NewLinkPolicy(LinkPolicyAllow, nil, []string{" Spam.Example "}),
+			content: "see HTTP://www.SPAM.example/x",
+			want:    Result{Action: Reject, Reason: "Links to www.spam.example are not allowed"},
+		},
+		{
+			name:    "every link denied",
+			policy:  NewLinkPolicy(LinkPolicyDeny, nil, nil),
+			content: "www.example.com",
+			want:    Result{Action: Reject, Reason: "Links are not allowed in this chat"},
+		},
+		{
+			name:    "on the allowlist",
+			policy:  NewLinkPolicy(LinkPolicyAllowlist, []string{"www.imdb.com"}, nil),
+			content: "www.imdb.com/title/tt0111161 and https://m.imdb.com",
+			want:    Result{Action: Allow, Content: "www.imdb.com/title/tt0111161 and https://m.imdb.com"},
+		},
+		{
+			name:    "off the allowlist",
+			policy:  NewLinkPolicy(LinkPolicyAllowlist, []string{"imdb.com"}, nil),
+			content: "https://imdb.com and https://notimdb.com",
+			want:    Result{Action: Reject, Reason: "Links to notimdb.com are not allowed"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.policy.Apply(&Message{Content: tc.content}); got != tc.want {
+				t.Fatalf("Apply(%q) = %+v, want %+v", tc.content, got, tc.want)
+			}
+		})
+	}
+}
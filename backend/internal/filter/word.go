@@ -0,0 +1,96 @@
+package filter
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	WordActionMask   = "mask"
+	WordActionReject = "reject"
+)
+
+// WordFilter masks or rejects messages containing any blocked word. Words
+// are matched whole and case-insensitively.
+type WordFilter struct {
+	pattern *regexp.Regexp
+	action  string
+}
+
+// notWord matches a character that cannot be part of a word. RE2's \b only
+// knows ASCII word characters and so never matches around words that start
+// or end in letters such as é or Cyrillic ones, so boundaries use this.
+const notWord = `[^\p{L}\p{M}\p{N}_]`
+
+func NewWordFilter(words []string, action string) *WordFilter {
+	f := &WordFilter{action: action}
+
+	quoted := make([]string, 0, len(words))
+	for _, w := range words {
+		if w = strings.TrimSpace(w); w != "" {
+			quoted = append(quoted, regexp.QuoteMeta(w))
+		}
+	}
+	if len(quoted) > 0 {
+		f.pattern = regexp.MustCompile(`(?i)(?:^|` + notWord + `)(` + strings.Join(quoted, "|") + `)(?:` + notWord + `|$)`)
+	}
+
+	return f
+}
+
+func (f *WordFilter) Apply(msg *Message) Result {
+	matches := f.find(msg.Content)
+	if len(matches) == 0 {
+		return allow(msg)
+	}
+
+	if f.action == WordActionReject {
+		return reject("Message contains blocked language")
+	}
+
+	var masked strings.Builder
+	last := 0
+	for _, m := range matches {
+		masked.WriteString(msg.Content[last:m[0]])
+		masked.WriteString(strings.Repeat("*", utf8.RuneCountInString(msg.Content[m[0]:m[1]])))
+		last = m[1]
+	}
+	masked.WriteString(msg.Content[last:])
+	return rewrite(masked.String())
+}
+
+// find returns where the blocked words in content start and end. The
+// boundaries around a word are part of the match, so the search resumes
+// right after each word, where the next one's leading boundary may be.
+func (f *WordFilter) find(content string) [][2]int {
+	if f.pattern == nil {
+		return nil
+	}
+
+	var found [][2]int
+	for at := 0; at < len(content); {
+		loc := f.pattern.FindStringSubmatchIndex(content[at:])
+		if loc == nil {
+			break
+		}
+		start, end := at+loc[2], at+loc[3]
+		if start > 0 && at == start && isWordEnd(content[:start]) {
+			// ^ matched at the resume point, after a word character.
+			_, size := utf8.DecodeRuneInString(content[at:])
+			at += size
+			continue
+		}
+		found = append(found, [2]int{start, end})
+		at = end
+	}
+	return found
+}
+
+// isWordEnd reports whether s ends in a character that can be part of a
+// word.
+func isWordEnd(s string) bool {
+	r, _ := utf8.DecodeLastRuneInString(s)
+	return r == '_' || unicode.IsLetter(r) || unicode.IsMark(r) || unicode.IsNumber(r)
+}
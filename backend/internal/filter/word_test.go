@@ -0,0 +1,39 @@
+package filter
+
+import "testing"
+
+func TestWordFilter(t *testing.T) {
+	words := []string{"darn", "café", "straße", "чёрт", "ab-c"}
+	for _, tc := range []struct {
+		name    string
+		action  string
+		content string
+		want    Result
+	}{
+		{"clean", WordActionMask, "what a nice film", Result{Action: Allow, Content: "what a nice film"}},
+		{"inside a word", WordActionMask, "darned", Result{Action: Allow, Content: "darned"}},
+		{"masked", WordActionMask, "Darn it, darn", Result{Action: Rewrite, Content: "**** it, ****"}},
+		{"adjacent", WordActionMask, "darn darn", Result{Action: Rewrite, Content: "**** ****"}},
+		{"accented", WordActionMask, "un CAFÉ noir", Result{Action: Rewrite, Content: "un **** noir"}},
+		{"accented inside a word", WordActionMask, "cafés", Result{Action: Allow, Content: "cafés"}},
+		{"non-ASCII ending", WordActionMask, "die straße.", Result{Action: Rewrite, Content: "die ******."}},
+		{"cyrillic", WordActionMask, "ну чёрт!", Result{Action: Rewrite, Content: "ну ****!"}},
+		{"cyrillic inside a word", WordActionMask, "чёртов", Result{Action: Allow, Content: "чёртов"}},
+		{"hyphenated inside a word", WordActionMask, "ab-cd", Result{Action: Allow, Content: "ab-cd"}},
+		{"rejected", WordActionReject, "oh darn", Result{Action: Reject, Reason: "Message contains blocked language"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f := NewWordFilter(words, tc.action)
+			if got := f.Apply(&Message{Content: tc.content}); got != tc.want {
+				t.Fatalf("Apply(%q) = %+v, want %+v", tc.content, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestWordFilterWithoutWords(t *testing.T) {
+	f := NewWordFilter([]string{" ", ""}, WordActionReject)
+	if got := f.Apply(&Message{Content: "anything"}); got.Action != Allow {
+		t.Fatalf("Apply() = %+v, want allow", got)
+	}
+}
@@ -0,0 +1,159 @@
+package handler
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kamdyns/movie-chat/internal/apperr"
+	"github.com/kamdyns/movie-chat/internal/model"
+	"github.com/kamdyns/movie-chat/internal/service"
+	ws "github.com/kamdyns/movie-chat/internal/websocket"
+)
+
+type AccountHandler struct {
+	accountService service.AccountService
+	hub            *ws.Hub
+}
+
+func NewAccountHandler(accountService service.AccountService, hub *ws.Hub) *AccountHandler {
+	return &AccountHandler{
+		accountService: accountService,
+		hub:            hub,
+	}
+}
+
+func (h *AccountHandler) DeleteAccount(c *gin.Context) {
+	userID := c.GetString("userID")
+	if err := h.accountService.DeleteAccount(c.Request.Context(), userID); err != nil {
+		c.Error(err)
+		return
+	}
+	h.hub.AccountDeleted(userID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account deleted successfully"})
+}
+
+// ExportData streams everything held about the user as a single JSON
+// document, or as a ZIP of JSON files with ?format=zip.
+func (h *AccountHandler) ExportData(c *gin.Context) {
+	userID := c.GetString("userID")
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "zip" {
+		c.Error(apperr.Validation("invalid_format", "Format must be json or zip"))
+		return
+	}
+
+	export, err := h.accountService.GetExport(c.Request.Context(), userID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	filename := fmt.Sprintf("movie-chat-export-%s.%s", time.Now().Format("20060102"), format)
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+	// Headers are sent by now, so a failure part way through can only be
+	// logged and the truncated download left for the client to reject.
+	if format == "zip" {
+		c.Header("Content-Type", "application/zip")
+		err = h.writeZip(c, userID, export)
+	} else {
+		c.Header("Content-Type", "application/json")
+		err = h.writeJSON(c, userID, export)
+	}
+	if err != nil {
+		log.Printf("failed to export data for %s: %v", userID, err)
+	}
+}
+
+func (h *AccountHandler) writeJSON(c *gin.Context, userID string, export *model.UserExport) error {
+	data, err := json.Marshal(export)
+	if err != nil {
+		return err
+	}
+
+	// Splice the streamed messages into the export object as a final field.
+	if _, err := c.Writer.Write(data[:len(data)-1]); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(c.Writer, `,"messages":`); err != nil {
+		return err
+	}
+	if err := h.streamMessages(c, userID, c.Writer); err != nil {
+		return err
+	}
+	_, err = io.WriteString(c.Writer, "}")
+	return err
+}
+
+func (h *AccountHandler) writeZip(c *gin.Context, userID string, export *model.UserExport) error {
+	zw := zip.NewWriter(c.Writer)
+
+	files := []struct {
+		name string
+		data any
+	}{
+		{"account.json", gin.H{"exported_at": export.ExportedAt, "user": export.User, "profile": export.Profile}},
+		{"rooms_created.json", export.RoomsCreated},
+		{"memberships.json", export.Memberships},
+		{"room_sessions.json", export.RoomSessions},
+		{"sign_in_sessions.json", export.SignIns},
+		{"blocked_users.json", export.BlockedUsers},
+	}
+	for _, f := range files {
+		w, err := zw.Create(f.name)
+		if err != nil {
+			return err
+		}
+		if err := json.NewEncoder(w).Encode(f.data); err != nil {
+			return err
+		}
+	}
+
+	w, err := zw.Create("messages.json")
+	if err != nil {
+		return err
+	}
+	if err := h.streamMessages(c, userID, w); err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+// streamMessages writes the user's messages to w as a JSON array, one
+// message at a time.
+func (h *AccountHandler) streamMessages(c *gin.Context, userID string, w io.Writer) error {
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+
+	first := true
+	err := h.accountService.StreamMessages(c.Request.Context(), userID, func(m *model.Message) error {
+		if !first {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		first = false
+
+		data, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, "]")
+	return err
+}
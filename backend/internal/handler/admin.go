@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kamdyns/movie-chat/internal/model"
+	"github.com/kamdyns/movie-chat/internal/service"
+	ws "github.com/kamdyns/movie-chat/internal/websocket"
+)
+
+type AdminHandler struct {
+	adminService service.AdminService
+	hub          *ws.Hub
+}
+
+func NewAdminHandler(adminService service.AdminService, hub *ws.Hub) *AdminHandler {
+	return &AdminHandler{
+		adminService: adminService,
+		hub:          hub,
+	}
+}
+
+func (h *AdminHandler) ListUsers(c *gin.Context) {
+	var params model.AdminUserListReq
+	if err := c.ShouldBindQuery(&params); err != nil {
+		c.Error(invalidRequest(err))
+		return
+	}
+
+	users, err := h.adminService.ListUsers(c.Request.Context(), &params)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, users)
+}
+
+func (h *AdminHandler) UpdateUser(c *gin.Context) {
+	var req model.AdminUpdateUserReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(invalidRequest(err))
+		return
+	}
+
+	userID := c.Param("id")
+	err := h.adminService.UpdateUser(c.Request.Context(), userID, c.GetString("userID"), &req)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if req.Suspended != nil && *req.Suspended {
+		h.hub.DisconnectUser(userID, "Your account has been suspended")
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User updated successfully"})
+}
+
+// ListRooms lists rooms in every state, with how many clients are
+// connected to each on this server.
+func (h *AdminHandler) ListRooms(c *gin.Context) {
+	var params model.AdminRoomListReq
+	if err := c.ShouldBindQuery(&params); err != nil {
+		c.Error(invalidRequest(err))
+		return
+	}
+
+	rooms, err := h.adminService.ListRooms(c.Request.Context(), &params)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	counts := h.hub.ConnectionCounts()
+	for i := range rooms.Rooms {
+		rooms.Rooms[i].Connections = counts[rooms.Rooms[i].ID.String()]
+	}
+
+	c.JSON(http.StatusOK, rooms)
+}
+
+func (h *AdminHandler) CloseRoom(c *gin.Context) {
+	roomID := c.Param("id")
+
+	err := h.adminService.CloseRoom(c.Request.Context(), roomID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	h.hub.CloseRoom(roomID, "This room has been closed by an admin")
+
+	c.JSON(http.StatusOK, gin.H{"message": "Room closed successfully"})
+}
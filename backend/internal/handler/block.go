@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kamdyns/movie-chat/internal/auth"
+	"github.com/kamdyns/movie-chat/internal/service"
+	ws "github.com/kamdyns/movie-chat/internal/websocket"
+)
+
+type BlockHandler struct {
+	blockService service.BlockService
+	hub          *ws.Hub
+}
+
+func NewBlockHandler(blockService service.BlockService, hub *ws.Hub) *BlockHandler {
+	return &BlockHandler{
+		blockService: blockService,
+		hub:          hub,
+	}
+}
+
+func (h *BlockHandler) BlockUser(c *gin.Context) {
+	userID := c.GetString("userID")
+	targetID := c.Param("id")
+
+	// The block references the caller's row, so make sure it exists.
+	if _, err := auth.CurrentUser(c); err != nil {
+		c.Error(err)
+		return
+	}
+
+	err := h.blockService.BlockUser(c.Request.Context(), userID, targetID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	h.hub.SetBlocked(userID, targetID, true)
+
+	c.JSON(http.StatusOK, gin.H{"message": "User blocked successfully"})
+}
+
+func (h *BlockHandler) UnblockUser(c *gin.Context) {
+	userID := c.GetString("userID")
+	targetID := c.Param("id")
+
+	if err := h.blockService.UnblockUser(c.Request.Context(), userID, targetID); err != nil {
+		c.Error(err)
+		return
+	}
+
+	h.hub.SetBlocked(userID, targetID, false)
+
+	c.JSON(http.StatusOK, gin.H{"message": "User unblocked successfully"})
+}
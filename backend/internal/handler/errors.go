@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kamdyns/movie-chat/internal/apperr"
+)
+
+// invalidRequest reports a body or query string that could not be bound.
+func invalidRequest(err error) error {
+	return apperr.Validation("invalid_request", err.Error())
+}
+
+// validatePaging checks the page and limit of a list request, as a zero
+// limit would divide by zero and a negative page or limit would produce a
+// negative offset.
+func validatePaging(page, limit, maxLimit int) error {
+	var fields []apperr.FieldError
+	if page < 1 {
+		fields = append(fields, apperr.FieldError{Field: "page", Message: "Must be at least 1"})
+	}
+	if limit < 1 || limit > maxLimit {
+		fields = append(fields, apperr.FieldError{Field: "limit", Message: fmt.Sprintf("Must be between 1 and %d", maxLimit)})
+	}
+	if len(fields) > 0 {
+		return apperr.Validation("invalid_request", "Some fields are invalid", fields...)
+	}
+	return nil
+}
+
+// bindStrictJSON decodes the body into obj, rejecting fields obj does not
+// have so clients learn when they send something that will be ignored, such
+// as created_by. Bad fields are reported individually.
+func bindStrictJSON(c *gin.Context, obj any) error {
+	dec := json.NewDecoder(c.Request.Body)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(obj)
+	if err == nil {
+		return nil
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return apperr.Validation("invalid_request", "Some fields are invalid", apperr.FieldError{
+			Field:   typeErr.Field,
+			Message: "Must be " + describeKind(typeErr.Type.Kind()),
+		})
+	}
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		return apperr.Validation("invalid_request", "Some fields are invalid", apperr.FieldError{
+			Field:   strings.Trim(field, `"`),
+			Message: "Unknown or read-only field",
+		})
+	}
+	return invalidRequest(err)
+}
+
+func describeKind(k reflect.Kind) string {
+	switch k {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "true or false"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "a whole number"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "a list"
+	default:
+		return "an object"
+	}
+}
@@ -0,0 +1,35 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kamdyns/movie-chat/internal/model"
+	"github.com/kamdyns/movie-chat/internal/service"
+)
+
+type HistoryHandler struct {
+	historyService service.HistoryService
+}
+
+func NewHistoryHandler(historyService service.HistoryService) *HistoryHandler {
+	return &HistoryHandler{
+		historyService: historyService,
+	}
+}
+
+func (h *HistoryHandler) GetUserHistory(c *gin.Context) {
+	var params model.UserHistoryReq
+	if err := c.ShouldBindQuery(&params); err != nil {
+		c.Error(invalidRequest(err))
+		return
+	}
+
+	history, err := h.historyService.GetUserHistory(c.Request.Context(), c.Param("id"), c.GetString("userID"), &params)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, history)
+}
@@ -0,0 +1,37 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kamdyns/movie-chat/internal/model"
+	"github.com/kamdyns/movie-chat/internal/service"
+)
+
+type MessageHandler struct {
+	messageService service.MessageService
+}
+
+func NewMessageHandler(messageService service.MessageService) *MessageHandler {
+	return &MessageHandler{
+		messageService: messageService,
+	}
+}
+
+// GetRoomMessages pages backwards through a room's history. Pass the
+// created_at of the oldest message received as before to get the next page.
+func (h *MessageHandler) GetRoomMessages(c *gin.Context) {
+	var params model.MessageHistoryReq
+	if err := c.ShouldBindQuery(&params); err != nil {
+		c.Error(invalidRequest(err))
+		return
+	}
+
+	messages, err := h.messageService.GetRoomMessages(c.Request.Context(), c.Param("id"), c.GetString("userID"), params.Before, params.Limit)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, model.MessageHistoryResponse{Messages: messages})
+}
@@ -2,16 +2,15 @@ package handler
 
 import (
 	"net/http"
-	"strconv"
-	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
 	"github.com/kamdyns/movie-chat/internal/model"
 	"github.com/kamdyns/movie-chat/internal/service"
-	"github.com/kamdyns/movie-chat/pkg/util"
 )
 
+// maxRoomPageSize is the most rooms GetRooms returns at once.
+const maxRoomPageSize = 100
+
 type RoomHandler struct {
 	roomService service.RoomService
 }
@@ -24,28 +23,14 @@ func NewRoomHandler(roomService service.RoomService) *RoomHandler {
 
 func (h *RoomHandler) CreateRoom(c *gin.Context) {
 	var req model.CreateRoomReq
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-
-	roomID, err := util.GenerateRoomID()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate room ID"})
+	if err := bindStrictJSON(c, &req); err != nil {
+		c.Error(err)
 		return
 	}
 
-	room := &model.Room{
-		ID:        roomID,
-		Name:      req.Name,
-		CreatedBy: c.GetString("userID"),
-		CreatedAt: time.Now(),
-		ExpiresAt: time.Now().Add(time.Duration(req.ExpiresIn) * time.Second),
-	}
-
-	createdRoom, err := h.roomService.CreateRoom(c.Request.Context(), room)
+	createdRoom, err := h.roomService.CreateRoom(c.Request.Context(), c.GetString("userID"), &req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
@@ -55,17 +40,21 @@ func (h *RoomHandler) CreateRoom(c *gin.Context) {
 func (h *RoomHandler) GetRooms(c *gin.Context) {
 	var params model.RoomListReq
 	if err := c.ShouldBindQuery(&params); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(invalidRequest(err))
+		return
+	}
+	if err := validatePaging(params.Page, params.Limit, maxRoomPageSize); err != nil {
+		c.Error(err)
 		return
 	}
 
 	rooms, totalCount, err := h.roomService.GetRooms(c.Request.Context(), params.Page, params.Limit)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve rooms"})
+		c.Error(err)
 		return
 	}
 
-	totalPages := (totalCount + params.Limit - 1) / params.Limit // Calculate total pages
+	totalPages := (totalCount + params.Limit - 1) / params.Limit
 
 	response := model.RoomListResponse{
 		Rooms:       rooms,
@@ -78,10 +67,9 @@ func (h *RoomHandler) GetRooms(c *gin.Context) {
 }
 
 func (h *RoomHandler) GetRoom(c *gin.Context) {
-	id := c.Param("id")
-	room, err := h.roomService.GetRoom(c.Request.Context(), id)
+	room, err := h.roomService.GetRoom(c.Request.Context(), c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
@@ -89,34 +77,24 @@ func (h *RoomHandler) GetRoom(c *gin.Context) {
 }
 
 func (h *RoomHandler) UpdateRoom(c *gin.Context) {
-	var room model.Room
-	if err := c.ShouldBindJSON(&room); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-
-	roomID, err := uuid.Parse(c.Param("id"))
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid room ID"})
+	var req model.UpdateRoomReq
+	if err := bindStrictJSON(c, &req); err != nil {
+		c.Error(err)
 		return
 	}
 
-	room.ID = roomID
-
-	updatedRoom, err := h.roomService.UpdateRoom(c.Request.Context(), &room)
+	room, err := h.roomService.UpdateRoom(c.Request.Context(), c.Param("id"), c.GetString("userID"), &req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
-	c.JSON(http.StatusOK, updatedRoom)
+	c.JSON(http.StatusOK, room)
 }
 
 func (h *RoomHandler) DeleteRoom(c *gin.Context) {
-	id := c.Param("id")
-	err := h.roomService.DeleteRoom(c.Request.Context(), id)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := h.roomService.DeleteRoom(c.Request.Context(), c.Param("id"), c.GetString("userID")); err != nil {
+		c.Error(err)
 		return
 	}
 
@@ -124,18 +102,14 @@ func (h *RoomHandler) DeleteRoom(c *gin.Context) {
 }
 
 func (h *RoomHandler) AddMember(c *gin.Context) {
-	roomID := c.Param("id")
-	var req struct {
-		UserID int64 `json:"user_id" binding:"required"`
-	}
+	var req model.AddMemberReq
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(invalidRequest(err))
 		return
 	}
 
-	err := h.roomService.AddMember(c.Request.Context(), roomID, req.UserID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := h.roomService.AddMember(c.Request.Context(), c.Param("id"), req.UserID, c.GetString("userID")); err != nil {
+		c.Error(err)
 		return
 	}
 
@@ -143,16 +117,8 @@ func (h *RoomHandler) AddMember(c *gin.Context) {
 }
 
 func (h *RoomHandler) RemoveMember(c *gin.Context) {
-	roomID := c.Param("id")
-	userID, err := strconv.ParseInt(c.Param("user_id"), 10, 64)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
-		return
-	}
-
-	err = h.roomService.RemoveMember(c.Request.Context(), roomID, userID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := h.roomService.RemoveMember(c.Request.Context(), c.Param("id"), c.Param("user_id"), c.GetString("userID")); err != nil {
+		c.Error(err)
 		return
 	}
 
@@ -160,10 +126,9 @@ func (h *RoomHandler) RemoveMember(c *gin.Context) {
 }
 
 func (h *RoomHandler) GetRoomMembers(c *gin.Context) {
-	roomID := c.Param("id")
-	members, err := h.roomService.GetRoomMembers(c.Request.Context(), roomID)
+	members, err := h.roomService.GetRoomMembers(c.Request.Context(), c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
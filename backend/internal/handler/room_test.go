@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kamdyns/movie-chat/internal/apperr"
+)
+
+func TestGetRoomsRejectsBadPaging(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(apperr.Middleware())
+	// The service is never reached, so none is needed.
+	r.GET("/rooms", NewRoomHandler(nil).GetRooms)
+
+	for query, field := range map[string]string{
+		"limit=0":   "limit",
+		"limit=-5":  "limit",
+		"limit=101": "limit",
+		"page=0":    "page",
+		"page=-1":   "page",
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/rooms?"+query, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", query, w.Code)
+			continue
+		}
+
+		var p apperr.Problem
+		if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+		if p.Code != "invalid_request" || len(p.Errors) != 1 || p.Errors[0].Field != field {
+			t.Errorf("%s: got %+v, want an invalid %s", query, p, field)
+		}
+	}
+}
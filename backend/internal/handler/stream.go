@@ -0,0 +1,293 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kamdyns/movie-chat/internal/apperr"
+	"github.com/kamdyns/movie-chat/internal/auth"
+	"github.com/kamdyns/movie-chat/internal/model"
+	"github.com/kamdyns/movie-chat/internal/service"
+	ws "github.com/kamdyns/movie-chat/internal/websocket"
+)
+
+// Long polls wait this long for a message by default, and at most
+// maxPollWait, which stays under common proxy idle timeouts.
+const (
+	defaultPollWait = 25 * time.Second
+	maxPollWait     = 55 * time.Second
+)
+
+var errHubUnavailable = apperr.Unavailable("chat_unavailable", "Chat is unavailable, try again shortly", nil)
+
+// StreamEvents sends a room's messages as server-sent events, for clients
+// that cannot open a websocket. Events carry the same messages as the
+// websocket, with the sequence number of chat messages as the event ID, so
+// a browser reconnecting on its own resumes where it left off.
+func (h *WebSocketHandler) StreamEvents(c *gin.Context) {
+	identity := auth.GetIdentity(c)
+	if identity == nil {
+		c.Error(apperr.Unauthorized("unauthenticated", "User not authenticated"))
+		return
+	}
+
+	lastSeq, err := lastSeqParam(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	user, err := auth.CurrentUser(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	rooms := newRoomSubscriptions(h, user.ClerkUserID)
+	client, err := rooms.Join(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	client.LastSeq = lastSeq
+
+	stream := &ws.Connection{
+		Message:   make(chan *ws.Message, h.hub.SendBuffer),
+		UserID:    user.ClerkUserID,
+		Username:  user.Username,
+		SessionID: identity.SessionID,
+		ExpiresAt: identity.ExpiresAt,
+		Rooms:     rooms,
+	}
+	if !stream.Open(h.hub, client) {
+		c.Error(errHubUnavailable)
+		return
+	}
+	defer stream.Close(h.hub)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	rc := http.NewResponseController(c.Writer)
+	keepAlive := h.hub.KeepAlive
+	// write sends an event, giving up on a peer that stops reading just as
+	// the websocket writer does.
+	write := func(event string) bool {
+		rc.SetWriteDeadline(time.Now().Add(keepAlive.WriteWait))
+		if _, err := c.Writer.WriteString(event); err != nil {
+			return false
+		}
+		return rc.Flush() == nil
+	}
+
+	if !write(": connected\n\n") {
+		return
+	}
+
+	ping := time.NewTicker(keepAlive.PingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case m := <-stream.Message:
+			if !write(formatEvent(m)) || m.Type == ws.MessageTypeRestart {
+				return
+			}
+		case <-ping.C:
+			if !write(": ping\n\n") {
+				return
+			}
+		case <-stream.Done():
+			code, reason := stream.CloseReason()
+			data, _ := json.Marshal(gin.H{"code": code, "reason": reason})
+			write("event: close\ndata: " + string(data) + "\n\n")
+			return
+		case <-c.Request.Context().Done():
+			return
+		}
+	}
+}
+
+// formatEvent encodes m as a server-sent event. Chat messages get their
+// sequence number as the event ID, and restart notices tell the browser how
+// long to wait before reconnecting.
+func formatEvent(m *ws.Message) string {
+	var b strings.Builder
+	if m.Seq > 0 && m.Type == ws.MessageTypeChat {
+		fmt.Fprintf(&b, "id: %d\n", m.Seq)
+	}
+	if m.Type == ws.MessageTypeRestart {
+		fmt.Fprintf(&b, "retry: %d\n", m.RetryAfter)
+	}
+	data, _ := json.Marshal(m)
+	fmt.Fprintf(&b, "data: %s\n\n", data)
+	return b.String()
+}
+
+// PollEvents returns a room's messages after last_seq, waiting up to wait
+// seconds for one if there are none yet. Between polls only chat messages
+// are kept, so clients poll again straight away with the highest seq they
+// have.
+func (h *WebSocketHandler) PollEvents(c *gin.Context) {
+	identity := auth.GetIdentity(c)
+	if identity == nil {
+		c.Error(apperr.Unauthorized("unauthenticated", "User not authenticated"))
+		return
+	}
+
+	lastSeq, err := lastSeqParam(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	wait := defaultPollWait
+	if v := c.Query("wait"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || time.Duration(n)*time.Second > maxPollWait {
+			c.Error(apperr.Validation("invalid_request", "Some fields are invalid", apperr.FieldError{
+				Field:   "wait",
+				Message: fmt.Sprintf("Must be between 0 and %d seconds", int(maxPollWait.Seconds())),
+			}))
+			return
+		}
+		wait = time.Duration(n) * time.Second
+	}
+
+	user, err := auth.CurrentUser(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	client, err := h.roomClient(c.Request.Context(), c.Param("id"), user.ClerkUserID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	client.LastSeq = lastSeq
+	client.Silent = true
+
+	poll := &ws.Connection{
+		Message:   make(chan *ws.Message, h.hub.SendBuffer),
+		UserID:    user.ClerkUserID,
+		Username:  user.Username,
+		SessionID: identity.SessionID,
+		ExpiresAt: identity.ExpiresAt,
+	}
+	if !poll.Open(h.hub, client) {
+		c.Error(errHubUnavailable)
+		return
+	}
+	defer poll.Close(h.hub)
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	messages := []*ws.Message{}
+	select {
+	case m := <-poll.Message:
+		messages = append(messages, m)
+	case <-timer.C:
+	case <-poll.Done():
+		c.Error(closeError(poll.CloseReason()))
+		return
+	case <-c.Request.Context().Done():
+		return
+	}
+
+	// Anything replayed arrives together, so take whatever else is queued.
+	for more := true; more; {
+		select {
+		case m := <-poll.Message:
+			messages = append(messages, m)
+		default:
+			more = false
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"messages": messages})
+}
+
+// closeError explains why the Hub ended a long poll.
+func closeError(code int, reason string) error {
+	switch code {
+	case ws.CloseSessionExpired:
+		return apperr.Unauthorized("session_expired", reason)
+	case ws.CloseRoomClosed:
+		return service.ErrRoomClosed
+	case ws.CloseSuspended:
+		return apperr.Forbidden("suspended", reason)
+	case ws.CloseAccountDeleted:
+		return apperr.Unauthorized("account_deleted", reason)
+	default:
+		return errHubUnavailable
+	}
+}
+
+// PostMessage sends a chat message to a room without a websocket. The
+// message goes through the same checks as one sent over the websocket, and
+// the response is its ack.
+func (h *WebSocketHandler) PostMessage(c *gin.Context) {
+	var req model.PostMessageReq
+	if err := bindStrictJSON(c, &req); err != nil {
+		c.Error(err)
+		return
+	}
+	if strings.TrimSpace(req.Content) == "" {
+		c.Error(apperr.Validation("invalid_request", "Some fields are invalid", apperr.FieldError{
+			Field:   "content",
+			Message: "Content is required",
+		}))
+		return
+	}
+
+	user, err := auth.CurrentUser(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	client, err := h.roomClient(c.Request.Context(), c.Param("id"), user.ClerkUserID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	client.ID = user.ClerkUserID
+	client.Username = user.Username
+
+	m, err := h.hub.Post(c.Request.Context(), client, req.ClientID, req.Content)
+	if err != nil {
+		c.Error(apperr.Unavailable("chat_unavailable", "Chat is unavailable, try again shortly", err))
+		return
+	}
+	if m.Type == ws.MessageTypeError {
+		c.Error(postError(m))
+		return
+	}
+
+	c.JSON(http.StatusCreated, m)
+}
+
+// postError turns the error message the Hub rejected a post with into the
+// matching REST error, keeping its code.
+func postError(m *ws.Message) error {
+	switch m.Code {
+	case ws.ErrorCodeRateLimited, ws.ErrorCodeRoomBusy, ws.ErrorCodeSlowMode:
+		return apperr.New(apperr.KindRateLimited, m.Code, m.Content)
+	case ws.ErrorCodeMembersOnly, ws.ErrorCodeEmojiOnly, ws.ErrorCodeForbidden:
+		return apperr.Forbidden(m.Code, m.Content)
+	case ws.ErrorCodeRejected:
+		return apperr.Validation(m.Code, m.Content)
+	default:
+		return apperr.Internal(errors.New(m.Content))
+	}
+}
@@ -1,32 +1,89 @@
 package handler
 
 import (
+	"encoding/json"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/kamdyns/movie-chat/internal/apperr"
+	"github.com/kamdyns/movie-chat/internal/auth"
 	"github.com/kamdyns/movie-chat/internal/model"
 	"github.com/kamdyns/movie-chat/internal/service"
+	"github.com/kamdyns/movie-chat/internal/webhook"
+	ws "github.com/kamdyns/movie-chat/internal/websocket"
 )
 
 type UserHandler struct {
 	userService service.UserService
+	verifier    *webhook.Verifier
+	hub         *ws.Hub
 }
 
-func NewUserHandler(userService service.UserService) *UserHandler {
-	return &UserHandler{userService: userService}
+func NewUserHandler(userService service.UserService, verifier *webhook.Verifier, hub *ws.Hub) *UserHandler {
+	return &UserHandler{userService: userService, verifier: verifier, hub: hub}
 }
 
 func (h *UserHandler) HandleClerkWebhook(c *gin.Context) {
+	body, err := c.GetRawData()
+	if err != nil {
+		c.Error(invalidRequest(err))
+		return
+	}
+
+	if err := h.verifier.Verify(c.Request.Header, body); err != nil {
+		c.Error(apperr.Unauthorized("invalid_signature", err.Error()))
+		return
+	}
+
 	var event model.ClerkWebhookEvent
-	if err := c.ShouldBindJSON(&event); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook payload"})
+	if err := json.Unmarshal(body, &event); err != nil {
+		c.Error(apperr.Validation("invalid_payload", "Invalid webhook payload"))
 		return
 	}
 
-	if err := h.userService.HandleClerkWebhook(c.Request.Context(), &event); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process webhook"})
+	if err := h.userService.HandleClerkWebhook(c.Request.Context(), c.GetHeader(webhook.HeaderID), &event); err != nil {
+		c.Error(err)
 		return
 	}
 
+	switch event.Type {
+	case model.ClerkEventUserDeleted:
+		h.hub.AccountDeleted(event.Data.ID)
+	case model.ClerkEventSessionEnded, model.ClerkEventSessionRemoved, model.ClerkEventSessionRevoked:
+		h.hub.EndSession(event.Data.ID)
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "Webhook processed successfully"})
 }
+
+func (h *UserHandler) GetProfile(c *gin.Context) {
+	profile, err := h.userService.GetProfile(c.Request.Context(), c.Param("id"), c.GetString("userID"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, profile)
+}
+
+func (h *UserHandler) UpdateProfile(c *gin.Context) {
+	var req model.UpdateProfileReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(invalidRequest(err))
+		return
+	}
+
+	// Users can edit their profile before the webhook has created them.
+	if _, err := auth.CurrentUser(c); err != nil {
+		c.Error(err)
+		return
+	}
+
+	profile, err := h.userService.UpdateProfile(c.Request.Context(), c.Param("id"), c.GetString("userID"), &req)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, profile)
+}
@@ -1,78 +1,235 @@
 package handler
 
 import (
+	"context"
+	"log"
 	"net/http"
+	"strconv"
+	"sync"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
-	repository "github.com/kamdyns/movie-chat/internal/repository"
+	"github.com/kamdyns/movie-chat/internal/apperr"
+	"github.com/kamdyns/movie-chat/internal/auth"
 	"github.com/kamdyns/movie-chat/internal/service"
 	ws "github.com/kamdyns/movie-chat/internal/websocket"
 )
 
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		return true // Adjust this for production!
-	},
+// UpgradeOptions configures websocket handshakes. Origins lists the pages
+// that may open a websocket. With Compression, clients that offer
+// permessage-deflate get messages of CompressionThreshold bytes or more
+// compressed.
+type UpgradeOptions struct {
+	Origins              *auth.Origins
+	ReadBufferSize       int
+	WriteBufferSize      int
+	Compression          bool
+	CompressionThreshold int
 }
 
 type WebSocketHandler struct {
-	hub            *ws.Hub
-	roomService    service.RoomService
-	userRepository repository.UserRepository
+	hub                  *ws.Hub
+	roomService          service.RoomService
+	blockService         service.BlockService
+	historyService       service.HistoryService
+	tickets              *auth.TicketStore
+	upgrader             websocket.Upgrader
+	compressionThreshold int
 }
 
-func NewWebSocketHandler(hub *ws.Hub, roomService service.RoomService, userRepository repository.UserRepository) *WebSocketHandler {
+func NewWebSocketHandler(hub *ws.Hub, roomService service.RoomService, blockService service.BlockService, historyService service.HistoryService, tickets *auth.TicketStore, opts UpgradeOptions) *WebSocketHandler {
 	return &WebSocketHandler{
-		hub:            hub,
-		roomService:    roomService,
-		userRepository: userRepository,
+		hub:                  hub,
+		roomService:          roomService,
+		blockService:         blockService,
+		historyService:       historyService,
+		tickets:              tickets,
+		upgrader:             newUpgrader(opts),
+		compressionThreshold: opts.CompressionThreshold,
 	}
 }
 
+func newUpgrader(opts UpgradeOptions) websocket.Upgrader {
+	return websocket.Upgrader{
+		ReadBufferSize:    opts.ReadBufferSize,
+		WriteBufferSize:   opts.WriteBufferSize,
+		EnableCompression: opts.Compression,
+		// Browsers send cookies with a cross-site handshake, so only the
+		// allowed origins may open one.
+		CheckOrigin: func(r *http.Request) bool {
+			if err := opts.Origins.Check(r); err != nil {
+				log.Printf("rejected websocket from %s: %v", r.RemoteAddr, err)
+				return false
+			}
+			return true
+		},
+		// Echo one of the offered protocols back, or browsers that passed
+		// their token in Sec-WebSocket-Protocol abort the handshake.
+		// MessagePack is preferred, as offering it is how clients ask for it.
+		Subprotocols: []string{ws.ProtocolMsgPack, auth.TokenProtocol},
+	}
+}
+
+// IssueTicket returns a single-use ticket the caller passes as the "ticket"
+// query parameter when opening a websocket.
+func (h *WebSocketHandler) IssueTicket(c *gin.Context) {
+	ticket, expiresAt, err := h.tickets.Issue(c.Request.Context(), auth.GetIdentity(c))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"ticket": ticket, "expires_at": expiresAt})
+}
+
+// HandleWebSocket opens a websocket for the user. The connection joins and
+// leaves rooms with subscribe and unsubscribe messages. The "roomId" query
+// parameter joins a room straight away, and a client reconnecting after a
+// drop passes the last sequence number it saw there as "last_seq" to be
+// sent the messages it missed.
 func (h *WebSocketHandler) HandleWebSocket(c *gin.Context) {
-	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	identity := auth.GetIdentity(c)
+	if identity == nil {
+		c.Error(apperr.Unauthorized("unauthenticated", "User not authenticated"))
+		return
+	}
+
+	lastSeq, err := lastSeqParam(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	user, err := auth.CurrentUser(c)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
-	roomID := c.Query("roomId")
-	clerkUserID, exists := c.Get("userID")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+	rooms := newRoomSubscriptions(h, user.ClerkUserID)
+
+	// The first room is checked before upgrading, so a client that cannot
+	// join it gets a proper HTTP error.
+	var initial []*ws.Client
+	if roomID := c.Query("roomId"); roomID != "" {
+		client, err := rooms.Join(c.Request.Context(), roomID)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		client.LastSeq = lastSeq
+		initial = append(initial, client)
+	}
+
+	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		for _, client := range initial {
+			rooms.Leave(client)
+		}
 		return
 	}
 
-	// Fetch user details from the database
-	user, err := h.userRepository.GetUserByClerkID(c.Request.Context(), clerkUserID.(string))
+	connection := &ws.Connection{
+		Conn:      conn,
+		Encoding:  ws.EncodingFor(conn.Subprotocol()),
+		Message:   make(chan *ws.Message, h.hub.SendBuffer),
+		UserID:    user.ClerkUserID,
+		Username:  user.Username,
+		SessionID: identity.SessionID,
+		ExpiresAt: identity.ExpiresAt,
+		Rooms:     rooms,
+
+		CompressionThreshold: h.compressionThreshold,
+	}
+	connection.Serve(c.Request.Context(), h.hub, initial...)
+}
+
+// roomSubscriptions checks each room a connection subscribes to, and
+// records how long the user spends in it for their history.
+type roomSubscriptions struct {
+	handler *WebSocketHandler
+	userID  string
+
+	mu       sync.Mutex
+	sessions map[*ws.Client]uuid.UUID
+}
+
+func newRoomSubscriptions(h *WebSocketHandler, userID string) *roomSubscriptions {
+	return &roomSubscriptions{
+		handler:  h,
+		userID:   userID,
+		sessions: make(map[*ws.Client]uuid.UUID),
+	}
+}
+
+func (s *roomSubscriptions) Join(ctx context.Context, roomID string) (*ws.Client, error) {
+	client, err := s.handler.roomClient(ctx, roomID, s.userID)
+	if err != nil {
+		return nil, err
+	}
+
+	sessionID, err := s.handler.historyService.StartSession(ctx, roomID, s.userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user details"})
+		log.Printf("failed to start session for %s in room %s: %v", s.userID, roomID, err)
+		return client, nil
+	}
+
+	s.mu.Lock()
+	s.sessions[client] = sessionID
+	s.mu.Unlock()
+	return client, nil
+}
+
+func (s *roomSubscriptions) Leave(client *ws.Client) {
+	s.mu.Lock()
+	sessionID, ok := s.sessions[client]
+	delete(s.sessions, client)
+	s.mu.Unlock()
+
+	if !ok {
 		return
 	}
+	if err := s.handler.historyService.EndSession(context.Background(), sessionID); err != nil {
+		log.Printf("failed to end session %s: %v", sessionID, err)
+	}
+}
 
-	client := &ws.Client{
-		Conn:     conn,
-		Message:  make(chan *ws.Message, 10),
-		ID:       user.ClerkUserID,
-		RoomID:   roomID,
-		Username: user.Username,
+// roomClient checks that userID may enter a room and describes them in it.
+// Every transport authorizes rooms through it.
+func (h *WebSocketHandler) roomClient(ctx context.Context, roomID, userID string) (*ws.Client, error) {
+	room, err := h.roomService.GetRoom(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+	if room.ClosedAt != nil {
+		return nil, service.ErrRoomClosed
 	}
 
-	h.hub.Register <- client
+	isMember, err := h.roomService.IsMember(ctx, roomID, userID)
+	if err != nil {
+		return nil, err
+	}
 
-	message := &ws.Message{
-		Content:  "A new user has joined the room",
-		RoomID:   roomID,
-		Username: user.Username,
+	// Blocks are loaded for every room rather than once per connection, as
+	// blocks made since connecting only reach rooms already joined.
+	blockedIDs, err := h.blockService.GetBlockedIDs(ctx, userID)
+	if err != nil {
+		return nil, err
 	}
 
-	h.hub.Broadcast <- message
+	blocked := make(map[string]bool, len(blockedIDs))
+	for _, id := range blockedIDs {
+		blocked[id] = true
+	}
 
-	go client.WriteMessage()
-	client.ReadMessage(h.hub)
+	return &ws.Client{
+		RoomID:      roomID,
+		RoomInfo:    room,
+		IsModerator: room.CreatedBy == userID,
+		IsMember:    isMember || room.CreatedBy == userID,
+		Blocked:     blocked,
+	}, nil
 }
 
 func (h *WebSocketHandler) JoinRoom(c *gin.Context) {
@@ -84,3 +241,25 @@ func (h *WebSocketHandler) LeaveRoom(c *gin.Context) {
 	// This is handled in HandleWebSocket, so we can remove this or keep it as a placeholder
 	c.JSON(http.StatusOK, gin.H{"message": "Use WebSocket connection to leave a room"})
 }
+
+// lastSeqParam reads the last sequence number a reconnecting client saw,
+// from the "last_seq" query parameter or, for event streams reconnected by
+// the browser, the Last-Event-ID header.
+func lastSeqParam(c *gin.Context) (int64, error) {
+	v := c.Query("last_seq")
+	if v == "" {
+		v = c.GetHeader("Last-Event-ID")
+	}
+	if v == "" {
+		return 0, nil
+	}
+
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return 0, apperr.Validation("invalid_request", "Some fields are invalid", apperr.FieldError{
+			Field:   "last_seq",
+			Message: "Must be a non-negative integer",
+		})
+	}
+	return n, nil
+}
@@ -0,0 +1,27 @@
+package model
+
+import "time"
+
+const (
+	DeletionPolicyAnonymize = "anonymize"
+	DeletionPolicyPurge     = "purge"
+)
+
+// UserExport is everything held about a user apart from their messages,
+// which are streamed separately as there can be any number of them.
+type UserExport struct {
+	ExportedAt   time.Time        `json:"exported_at"`
+	User         User             `json:"user"`
+	Profile      *UserProfile     `json:"profile"`
+	RoomsCreated []Room           `json:"rooms_created"`
+	Memberships  []ExportedMember `json:"memberships"`
+	RoomSessions []RoomSession    `json:"room_sessions"`
+	SignIns      []Session        `json:"sign_in_sessions"`
+	BlockedUsers []UserBlock      `json:"blocked_users"`
+}
+
+type ExportedMember struct {
+	RoomID   string    `json:"room_id"`
+	RoomName string    `json:"room_name"`
+	JoinedAt time.Time `json:"joined_at"`
+}
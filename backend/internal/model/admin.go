@@ -0,0 +1,66 @@
+package model
+
+import "time"
+
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+const (
+	RoomStatusActive  = "active"
+	RoomStatusExpired = "expired"
+	RoomStatusClosed  = "closed"
+)
+
+// AdminUser is a user as platform admins see it, including the email and
+// account state hidden from other users.
+type AdminUser struct {
+	UserID      string     `json:"user_id"`
+	Username    string     `json:"username"`
+	Email       string     `json:"email"`
+	Role        string     `json:"role"`
+	SuspendedAt *time.Time `json:"suspended_at"`
+	DeletedAt   *time.Time `json:"deleted_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+type AdminUserListReq struct {
+	Query string `form:"q"`
+	Page  int    `form:"page,default=1"`
+	Limit int    `form:"limit,default=20"`
+}
+
+type AdminUserListResponse struct {
+	Users       []AdminUser `json:"users"`
+	TotalCount  int         `json:"totalCount"`
+	CurrentPage int         `json:"currentPage"`
+	TotalPages  int         `json:"totalPages"`
+}
+
+// AdminUpdateUserReq changes only the fields that are present.
+type AdminUpdateUserReq struct {
+	Role      *string `json:"role"`
+	Suspended *bool   `json:"suspended"`
+}
+
+// AdminRoom is a room in any state. Connections is the number of clients
+// connected to it on this server right now.
+type AdminRoom struct {
+	Room
+	Status      string `json:"status"`
+	Connections int    `json:"connections"`
+}
+
+type AdminRoomListReq struct {
+	Status string `form:"status"`
+	Page   int    `form:"page,default=1"`
+	Limit  int    `form:"limit,default=20"`
+}
+
+type AdminRoomListResponse struct {
+	Rooms       []AdminRoom `json:"rooms"`
+	TotalCount  int         `json:"totalCount"`
+	CurrentPage int         `json:"currentPage"`
+	TotalPages  int         `json:"totalPages"`
+}
@@ -0,0 +1,44 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RoomSession is one websocket connection to a room. LeftAt is nil while
+// the user is still connected.
+type RoomSession struct {
+	ID              uuid.UUID  `json:"id"`
+	RoomID          string     `json:"room_id"`
+	UserID          string     `json:"user_id"`
+	JoinedAt        time.Time  `json:"joined_at"`
+	LeftAt          *time.Time `json:"left_at"`
+	DurationSeconds int64      `json:"duration_seconds"`
+}
+
+type RoomHistory struct {
+	RoomID               string        `json:"room_id"`
+	RoomName             string        `json:"room_name"`
+	MovieTitle           string        `json:"movie_title"`
+	FirstJoinedAt        time.Time     `json:"first_joined_at"`
+	LastJoinedAt         time.Time     `json:"last_joined_at"`
+	TotalDurationSeconds int64         `json:"total_duration_seconds"`
+	Sessions             []RoomSession `json:"sessions"`
+	Messages             []Message     `json:"messages"`
+}
+
+type UserHistoryReq struct {
+	Page          int       `form:"page,default=1"`
+	Limit         int       `form:"limit,default=20"`
+	From          time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+	To            time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+	MessagesLimit int       `form:"messages_limit,default=20"`
+}
+
+type UserHistoryResponse struct {
+	Rooms       []RoomHistory `json:"rooms"`
+	TotalCount  int           `json:"totalCount"`
+	CurrentPage int           `json:"currentPage"`
+	TotalPages  int           `json:"totalPages"`
+}
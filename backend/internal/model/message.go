@@ -0,0 +1,33 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Message struct {
+	ID        uuid.UUID `json:"id"`
+	Seq       int64     `json:"seq,omitempty"`
+	RoomID    string    `json:"room_id"`
+	UserID    string    `json:"user_id"`
+	Username  string    `json:"username"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type MessageHistoryReq struct {
+	Before time.Time `form:"before" time_format:"2006-01-02T15:04:05Z07:00"`
+	Limit  int       `form:"limit,default=50"`
+}
+
+type MessageHistoryResponse struct {
+	Messages []Message `json:"messages"`
+}
+
+// PostMessageReq sends a chat message without a websocket. ClientID is
+// echoed in the ack, as on the websocket.
+type PostMessageReq struct {
+	Content  string `json:"content"`
+	ClientID string `json:"client_id"`
+}
@@ -7,23 +7,48 @@ import (
 )
 
 type RoomMember struct {
-	ID       int64     `json:"id"`
 	RoomID   string    `json:"room_id"`
-	UserID   int64     `json:"user_id"`
+	UserID   string    `json:"user_id"`
+	Username string    `json:"username"`
 	JoinedAt time.Time `json:"joined_at"`
 }
 
 type Room struct {
-	ID        uuid.UUID `json:"id"`
-	Name      string    `json:"name"`
-	CreatedBy string    `json:"created_by"`
-	CreatedAt time.Time `json:"created_at"`
-	ExpiresAt time.Time `json:"expires_at"`
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	MovieTitle string     `json:"movie_title"`
+	CreatedBy  string     `json:"created_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	ClosedAt   *time.Time `json:"closed_at,omitempty"`
+	Modes      RoomModes  `json:"modes"`
 }
 
+// RoomModes are the crowd control settings moderators can toggle while a
+// room is live. SlowModeSeconds of zero disables slow mode.
+type RoomModes struct {
+	SlowModeSeconds int  `json:"slow_mode_seconds"`
+	MembersOnly     bool `json:"members_only"`
+	EmojiOnly       bool `json:"emoji_only"`
+}
+
+// CreateRoomReq is a new room. ExpiresIn is the room's lifetime in seconds.
 type CreateRoomReq struct {
-	Name      string `json:"name"`
-	ExpiresIn int64  `json:"expires_in"`
+	Name       string `json:"name"`
+	MovieTitle string `json:"movie_title"`
+	ExpiresIn  int64  `json:"expires_in"`
+}
+
+// UpdateRoomReq changes only the fields that are present. ExpiresIn moves
+// the expiry to that many seconds from now.
+type UpdateRoomReq struct {
+	Name       *string `json:"name"`
+	MovieTitle *string `json:"movie_title"`
+	ExpiresIn  *int64  `json:"expires_in"`
+}
+
+type AddMemberReq struct {
+	UserID string `json:"user_id" binding:"required"`
 }
 
 type RoomListResponse struct {
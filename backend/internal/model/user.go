@@ -7,23 +7,99 @@ import (
 )
 
 type User struct {
-	ID          uuid.UUID `json:"id" db:"id"`
-	ClerkUserID string    `json:"clerk_user_id" db:"clerk_user_id"`
-	Username    string    `json:"username" db:"username"`
-	Email       string    `json:"email" db:"email"`
-	CreatedAt   time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+	ID          uuid.UUID  `json:"id" db:"id"`
+	ClerkUserID string     `json:"clerk_user_id" db:"clerk_user_id"`
+	Username    string     `json:"username" db:"username"`
+	Email       string     `json:"email" db:"email"`
+	Role        string     `json:"role" db:"role"`
+	SuspendedAt *time.Time `json:"suspended_at" db:"suspended_at"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at" db:"updated_at"`
 }
 
+// UserProfile is what other users can see about someone. It deliberately
+// has no email. NotificationPreferences is only filled in for the owner.
+type UserProfile struct {
+	UserID                  string                   `json:"user_id"`
+	Username                string                   `json:"username"`
+	DisplayName             string                   `json:"display_name"`
+	AvatarURL               string                   `json:"avatar_url"`
+	Bio                     string                   `json:"bio"`
+	FavoriteGenres          []string                 `json:"favorite_genres"`
+	NotificationPreferences *NotificationPreferences `json:"notification_preferences,omitempty"`
+	CreatedAt               time.Time                `json:"created_at"`
+}
+
+type NotificationPreferences struct {
+	RoomStarting bool `json:"room_starting"`
+	Mentions     bool `json:"mentions"`
+	Email        bool `json:"email"`
+}
+
+// UpdateProfileReq changes only the fields that are present.
+type UpdateProfileReq struct {
+	DisplayName             *string                  `json:"display_name"`
+	AvatarURL               *string                  `json:"avatar_url"`
+	Bio                     *string                  `json:"bio"`
+	FavoriteGenres          []string                 `json:"favorite_genres"`
+	NotificationPreferences *NotificationPreferences `json:"notification_preferences"`
+}
+
+const (
+	ClerkEventUserCreated    = "user.created"
+	ClerkEventUserUpdated    = "user.updated"
+	ClerkEventUserDeleted    = "user.deleted"
+	ClerkEventSessionCreated = "session.created"
+	ClerkEventSessionEnded   = "session.ended"
+	ClerkEventSessionRemoved = "session.removed"
+	ClerkEventSessionRevoked = "session.revoked"
+)
+
+// ClerkWebhookEvent covers the user and session payloads we handle. For
+// user events Data.ID is the user, for session events it is the session and
+// Data.UserID is the user.
 type ClerkWebhookEvent struct {
 	Type string `json:"type"`
 	Data struct {
-		ID       string `json:"id"`
-		Username string `json:"username"`
-		Email    string `json:"email_address"`
+		ID                    string              `json:"id"`
+		Username              string              `json:"username"`
+		Email                 string              `json:"email_address"`
+		EmailAddresses        []ClerkEmailAddress `json:"email_addresses"`
+		PrimaryEmailAddressID string              `json:"primary_email_address_id"`
+		UserID                string              `json:"user_id"`
+		Status                string              `json:"status"`
+		Deleted               bool                `json:"deleted"`
 	} `json:"data"`
 }
 
+type ClerkEmailAddress struct {
+	ID           string `json:"id"`
+	EmailAddress string `json:"email_address"`
+}
+
+// PrimaryEmail picks the user's primary address out of email_addresses,
+// falling back to the flat email_address field.
+func (e *ClerkWebhookEvent) PrimaryEmail() string {
+	for _, addr := range e.Data.EmailAddresses {
+		if addr.ID == e.Data.PrimaryEmailAddressID {
+			return addr.EmailAddress
+		}
+	}
+	if e.Data.Email == "" && len(e.Data.EmailAddresses) > 0 {
+		return e.Data.EmailAddresses[0].EmailAddress
+	}
+	return e.Data.Email
+}
+
+// Session is a Clerk sign-in session as reported by its webhooks.
+type Session struct {
+	ID        string     `json:"id"`
+	UserID    string     `json:"user_id"`
+	Status    string     `json:"status"`
+	CreatedAt time.Time  `json:"created_at"`
+	EndedAt   *time.Time `json:"ended_at"`
+}
+
 type ClientRes struct {
 	ID       string `json:"id"`
 	Username string `json:"username"`
@@ -0,0 +1,119 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Bucket is a token bucket that refills at rate tokens per second up to
+// burst tokens. It is safe for concurrent use.
+type Bucket struct {
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func NewBucket(rate float64, burst int) *Bucket {
+	return &Bucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Allow takes a token from the bucket, reporting false if none are left.
+// A bucket with a non-positive rate never limits.
+func (b *Bucket) Allow() bool {
+	if b.rate <= 0 {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// RetryAfter is how long a caller should wait for the next token.
+func (b *Bucket) RetryAfter() time.Duration {
+	if b.rate <= 0 {
+		return 0
+	}
+	return time.Duration(float64(time.Second) / b.rate)
+}
+
+// idle reports whether the bucket has been untouched long enough to have
+// refilled completely, at which point it is equivalent to a fresh one.
+func (b *Bucket) idle(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return now.Sub(b.last).Seconds()*b.rate >= b.burst
+}
+
+// Limiter keeps a Bucket per key, such as a user or room ID.
+type Limiter struct {
+	rate  float64
+	burst int
+
+	mu      sync.Mutex
+	buckets map[string]*Bucket
+	calls   int
+}
+
+func NewLimiter(rate float64, burst int) *Limiter {
+	return &Limiter{
+		rate:    rate,
+		burst:   burst,
+		buckets: make(map[string]*Bucket),
+	}
+}
+
+// Allow takes a token from key's bucket. A limiter with a non-positive rate
+// never limits, so it keeps no buckets either.
+func (l *Limiter) Allow(key string) bool {
+	if l.rate <= 0 {
+		return true
+	}
+	return l.bucket(key).Allow()
+}
+
+func (l *Limiter) RetryAfter() time.Duration {
+	return NewBucket(l.rate, l.burst).RetryAfter()
+}
+
+func (l *Limiter) bucket(key string) *Bucket {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.calls++
+	if l.calls%1000 == 0 {
+		now := time.Now()
+		for k, b := range l.buckets {
+			if b.idle(now) {
+				delete(l.buckets, k)
+			}
+		}
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = NewBucket(l.rate, l.burst)
+		l.buckets[key] = b
+	}
+	return b
+}
@@ -0,0 +1,47 @@
+package ratelimit
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestBucketLimitsToBurst(t *testing.T) {
+	b := NewBucket(1, 3)
+	for i := 0; i < 3; i++ {
+		if !b.Allow() {
+			t.Fatalf("request %d was limited within the burst", i)
+		}
+	}
+	if b.Allow() {
+		t.Fatal("request beyond the burst was allowed")
+	}
+	if got := b.RetryAfter(); got != time.Second {
+		t.Fatalf("RetryAfter() = %s, want 1s", got)
+	}
+}
+
+func TestLimiterDisabledKeepsNoBuckets(t *testing.T) {
+	l := NewLimiter(0, 0)
+	for i := 0; i < 5000; i++ {
+		if !l.Allow(fmt.Sprint(i)) {
+			t.Fatal("disabled limiter limited a request")
+		}
+	}
+	if n := len(l.buckets); n != 0 {
+		t.Fatalf("disabled limiter kept %d buckets", n)
+	}
+}
+
+func TestLimiterDropsIdleBuckets(t *testing.T) {
+	l := NewLimiter(1000, 1)
+	l.Allow("idle")
+	time.Sleep(5 * time.Millisecond)
+
+	for i := 0; i < 1000; i++ {
+		l.Allow("busy")
+	}
+	if _, ok := l.buckets["idle"]; ok {
+		t.Fatal("idle bucket was not dropped")
+	}
+}
@@ -0,0 +1,219 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/kamdyns/movie-chat/internal/model"
+)
+
+type AccountRepository interface {
+	AnonymizeUser(ctx context.Context, clerkUserID, replacementID string) error
+	PurgeUser(ctx context.Context, clerkUserID string) error
+	GetExport(ctx context.Context, clerkUserID string) (*model.UserExport, error)
+	StreamMessages(ctx context.Context, clerkUserID string, fn func(*model.Message) error) error
+}
+
+type accountRepository struct {
+	db       *sql.DB
+	userRepo UserRepository
+}
+
+func NewAccountRepository(db *sql.DB, userRepo UserRepository) AccountRepository {
+	return &accountRepository{db: db, userRepo: userRepo}
+}
+
+// tombstoneQuery records a deleted Clerk user ID, which the user repository
+// then refuses to create a user for again.
+const tombstoneQuery = `INSERT INTO deleted_accounts(clerk_user_id) VALUES ($1) ON CONFLICT DO NOTHING`
+
+// AnonymizeUser keeps the user's messages and rooms but strips everything
+// that identifies them. The user row is kept under replacementID so that
+// messages still have an author, shown as "deleted-user".
+func (r *accountRepository) AnonymizeUser(ctx context.Context, clerkUserID, replacementID string) error {
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		statements := []string{
+			tombstoneQuery,
+			`DELETE FROM user_blocks WHERE blocker_id = $1 OR blocked_id = $1`,
+			`DELETE FROM room_sessions WHERE user_id = $1`,
+			`DELETE FROM clerk_sessions WHERE user_id = $1`,
+			`DELETE FROM room_members WHERE user_id = (SELECT id FROM users WHERE clerk_user_id = $1)`,
+		}
+		for _, query := range statements {
+			if _, err := tx.ExecContext(ctx, query, clerkUserID); err != nil {
+				return dbError(err)
+			}
+		}
+
+		if _, err := tx.ExecContext(ctx, `UPDATE rooms SET created_by = $2 WHERE created_by = $1`, clerkUserID, replacementID); err != nil {
+			return dbError(err)
+		}
+
+		query := `
+			UPDATE users
+			SET clerk_user_id = $2, username = 'deleted-user', email = '', display_name = '', avatar_url = '',
+				bio = '', favorite_genres = '{}', deleted_at = NOW()
+			WHERE clerk_user_id = $1
+		`
+		_, err := tx.ExecContext(ctx, query, clerkUserID, replacementID)
+		return dbError(err)
+	})
+}
+
+// PurgeUser deletes the user, the rooms they created and, through the
+// foreign keys, their messages, memberships, blocks and sessions.
+func (r *accountRepository) PurgeUser(ctx context.Context, clerkUserID string) error {
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, tombstoneQuery, clerkUserID); err != nil {
+			return dbError(err)
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM rooms WHERE created_by = $1`, clerkUserID); err != nil {
+			return dbError(err)
+		}
+		_, err := tx.ExecContext(ctx, `DELETE FROM users WHERE clerk_user_id = $1`, clerkUserID)
+		return dbError(err)
+	})
+}
+
+func (r *accountRepository) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return dbError(err)
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return dbError(err)
+	}
+	return tx.Commit()
+}
+
+func (r *accountRepository) GetExport(ctx context.Context, clerkUserID string) (*model.UserExport, error) {
+	user, err := r.userRepo.GetUserByClerkID(ctx, clerkUserID)
+	if err != nil {
+		return nil, dbError(err)
+	}
+	profile, err := r.userRepo.GetProfile(ctx, clerkUserID)
+	if err != nil {
+		return nil, dbError(err)
+	}
+
+	export := &model.UserExport{
+		ExportedAt:   time.Now(),
+		User:         *user,
+		Profile:      profile,
+		RoomsCreated: []model.Room{},
+		Memberships:  []model.ExportedMember{},
+		RoomSessions: []model.RoomSession{},
+		SignIns:      []model.Session{},
+		BlockedUsers: []model.UserBlock{},
+	}
+
+	err = r.query(ctx, `
+		SELECT id, name, movie_title, created_by, created_at, expires_at
+		FROM rooms WHERE created_by = $1 ORDER BY created_at`, clerkUserID, func(rows *sql.Rows) error {
+		var room model.Room
+		if err := rows.Scan(&room.ID, &room.Name, &room.MovieTitle, &room.CreatedBy, &room.CreatedAt, &room.ExpiresAt); err != nil {
+			return dbError(err)
+		}
+		export.RoomsCreated = append(export.RoomsCreated, room)
+		return nil
+	})
+	if err != nil {
+		return nil, dbError(err)
+	}
+
+	err = r.query(ctx, `
+		SELECT rm.room_id, r.name, rm.joined_at
+		FROM room_members rm
+		JOIN users u ON u.id = rm.user_id
+		JOIN rooms r ON r.id = rm.room_id
+		WHERE u.clerk_user_id = $1 ORDER BY rm.joined_at`, clerkUserID, func(rows *sql.Rows) error {
+		var m model.ExportedMember
+		if err := rows.Scan(&m.RoomID, &m.RoomName, &m.JoinedAt); err != nil {
+			return dbError(err)
+		}
+		export.Memberships = append(export.Memberships, m)
+		return nil
+	})
+	if err != nil {
+		return nil, dbError(err)
+	}
+
+	err = r.query(ctx, `
+		SELECT id, room_id, user_id, joined_at, left_at,
+			EXTRACT(EPOCH FROM COALESCE(left_at, NOW()) - joined_at)::BIGINT
+		FROM room_sessions WHERE user_id = $1 ORDER BY joined_at`, clerkUserID, func(rows *sql.Rows) error {
+		var s model.RoomSession
+		if err := rows.Scan(&s.ID, &s.RoomID, &s.UserID, &s.JoinedAt, &s.LeftAt, &s.DurationSeconds); err != nil {
+			return dbError(err)
+		}
+		export.RoomSessions = append(export.RoomSessions, s)
+		return nil
+	})
+	if err != nil {
+		return nil, dbError(err)
+	}
+
+	err = r.query(ctx, `
+		SELECT id, user_id, status, created_at, ended_at
+		FROM clerk_sessions WHERE user_id = $1 ORDER BY created_at`, clerkUserID, func(rows *sql.Rows) error {
+		var s model.Session
+		if err := rows.Scan(&s.ID, &s.UserID, &s.Status, &s.CreatedAt, &s.EndedAt); err != nil {
+			return dbError(err)
+		}
+		export.SignIns = append(export.SignIns, s)
+		return nil
+	})
+	if err != nil {
+		return nil, dbError(err)
+	}
+
+	err = r.query(ctx, `
+		SELECT blocker_id, blocked_id, created_at
+		FROM user_blocks WHERE blocker_id = $1 ORDER BY created_at`, clerkUserID, func(rows *sql.Rows) error {
+		var b model.UserBlock
+		if err := rows.Scan(&b.BlockerID, &b.BlockedID, &b.CreatedAt); err != nil {
+			return dbError(err)
+		}
+		export.BlockedUsers = append(export.BlockedUsers, b)
+		return nil
+	})
+	if err != nil {
+		return nil, dbError(err)
+	}
+
+	return export, nil
+}
+
+// StreamMessages calls fn with each of the user's messages, oldest first,
+// without loading them all into memory.
+func (r *accountRepository) StreamMessages(ctx context.Context, clerkUserID string, fn func(*model.Message) error) error {
+	return r.query(ctx, `
+		SELECT m.id, m.room_id, u.clerk_user_id, u.username, m.content, m.created_at
+		FROM messages m
+		JOIN users u ON u.id = m.user_id
+		WHERE u.clerk_user_id = $1
+		ORDER BY m.created_at`, clerkUserID, func(rows *sql.Rows) error {
+		var m model.Message
+		if err := rows.Scan(&m.ID, &m.RoomID, &m.UserID, &m.Username, &m.Content, &m.CreatedAt); err != nil {
+			return dbError(err)
+		}
+		return fn(&m)
+	})
+}
+
+func (r *accountRepository) query(ctx context.Context, query, clerkUserID string, scan func(*sql.Rows) error) error {
+	rows, err := r.db.QueryContext(ctx, query, clerkUserID)
+	if err != nil {
+		return dbError(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return dbError(err)
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,154 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/kamdyns/movie-chat/internal/model"
+)
+
+type AdminRepository interface {
+	ListUsers(ctx context.Context, search string, limit, offset int) ([]model.AdminUser, error)
+	CountUsers(ctx context.Context, search string) (int, error)
+	SetUserRole(ctx context.Context, clerkUserID, role string) error
+	SetUserSuspended(ctx context.Context, clerkUserID string, suspended bool) error
+	ListRooms(ctx context.Context, status string, limit, offset int) ([]model.AdminRoom, error)
+	CountRooms(ctx context.Context, status string) (int, error)
+	CloseRoom(ctx context.Context, roomID string) error
+}
+
+type adminRepository struct {
+	db *sql.DB
+}
+
+func NewAdminRepository(db *sql.DB) AdminRepository {
+	return &adminRepository{db: db}
+}
+
+// userSearch matches the username or email by substring, or the user ID
+// exactly. An empty search matches everyone.
+const userSearch = `
+	($1 = '' OR clerk_user_id = $1 OR username ILIKE '%' || $1 || '%' OR email ILIKE '%' || $1 || '%')
+`
+
+func (r *adminRepository) ListUsers(ctx context.Context, search string, limit, offset int) ([]model.AdminUser, error) {
+	query := `
+		SELECT clerk_user_id, username, email, role, suspended_at, deleted_at, created_at
+		FROM users
+		WHERE ` + userSearch + `
+		ORDER BY created_at DESC
+		LIMIT $2 OFFSET $3
+	`
+	rows, err := r.db.QueryContext(ctx, query, search, limit, offset)
+	if err != nil {
+		return nil, dbError(err)
+	}
+	defer rows.Close()
+
+	users := []model.AdminUser{}
+	for rows.Next() {
+		var u model.AdminUser
+		if err := rows.Scan(&u.UserID, &u.Username, &u.Email, &u.Role, &u.SuspendedAt, &u.DeletedAt, &u.CreatedAt); err != nil {
+			return nil, dbError(err)
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+func (r *adminRepository) CountUsers(ctx context.Context, search string) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM users WHERE `+userSearch, search).Scan(&count)
+	return count, dbError(err)
+}
+
+func (r *adminRepository) SetUserRole(ctx context.Context, clerkUserID, role string) error {
+	res, err := r.db.ExecContext(ctx, `UPDATE users SET role = $2 WHERE clerk_user_id = $1`, clerkUserID, role)
+	if err != nil {
+		return dbError(err)
+	}
+	return dbError(requireRow(res))
+}
+
+// SetUserSuspended keeps the original suspension time if the user is
+// suspended again.
+func (r *adminRepository) SetUserSuspended(ctx context.Context, clerkUserID string, suspended bool) error {
+	query := `UPDATE users SET suspended_at = NULL WHERE clerk_user_id = $1`
+	if suspended {
+		query = `UPDATE users SET suspended_at = COALESCE(suspended_at, NOW()) WHERE clerk_user_id = $1`
+	}
+	res, err := r.db.ExecContext(ctx, query, clerkUserID)
+	if err != nil {
+		return dbError(err)
+	}
+	return dbError(requireRow(res))
+}
+
+// roomStatus derives a room's status. A closed room is also expired, so
+// closed is checked first.
+const roomStatus = `
+	CASE
+		WHEN closed_at IS NOT NULL THEN 'closed'
+		WHEN expires_at <= NOW() THEN 'expired'
+		ELSE 'active'
+	END
+`
+
+func (r *adminRepository) ListRooms(ctx context.Context, status string, limit, offset int) ([]model.AdminRoom, error) {
+	query := `
+		SELECT id, name, movie_title, created_by, created_at, expires_at, closed_at,
+			slow_mode_seconds, members_only, emoji_only, status
+		FROM (SELECT *, ` + roomStatus + ` AS status FROM rooms) r
+		WHERE $1 = '' OR status = $1
+		ORDER BY created_at DESC
+		LIMIT $2 OFFSET $3
+	`
+	rows, err := r.db.QueryContext(ctx, query, status, limit, offset)
+	if err != nil {
+		return nil, dbError(err)
+	}
+	defer rows.Close()
+
+	rooms := []model.AdminRoom{}
+	for rows.Next() {
+		var room model.AdminRoom
+		if err := rows.Scan(&room.ID, &room.Name, &room.MovieTitle, &room.CreatedBy, &room.CreatedAt, &room.ExpiresAt, &room.ClosedAt,
+			&room.Modes.SlowModeSeconds, &room.Modes.MembersOnly, &room.Modes.EmojiOnly, &room.Status); err != nil {
+			return nil, dbError(err)
+		}
+		rooms = append(rooms, room)
+	}
+	return rooms, rows.Err()
+}
+
+func (r *adminRepository) CountRooms(ctx context.Context, status string) (int, error) {
+	query := `SELECT COUNT(*) FROM rooms WHERE $1 = '' OR ` + roomStatus + ` = $1`
+	var count int
+	err := r.db.QueryRowContext(ctx, query, status).Scan(&count)
+	return count, dbError(err)
+}
+
+func (r *adminRepository) CloseRoom(ctx context.Context, roomID string) error {
+	query := `
+		UPDATE rooms
+		SET closed_at = COALESCE(closed_at, NOW()), expires_at = LEAST(expires_at, NOW())
+		WHERE id = $1
+	`
+	res, err := r.db.ExecContext(ctx, query, roomID)
+	if err != nil {
+		return dbError(err)
+	}
+	return dbError(requireRow(res))
+}
+
+// requireRow turns an update that matched nothing into sql.ErrNoRows.
+func requireRow(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return dbError(err)
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
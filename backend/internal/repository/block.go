@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+)
+
+type BlockRepository interface {
+	BlockUser(ctx context.Context, blockerID, blockedID string) error
+	UnblockUser(ctx context.Context, blockerID, blockedID string) error
+	GetBlockedIDs(ctx context.Context, blockerID string) ([]string, error)
+}
+
+type blockRepository struct {
+	db *sql.DB
+}
+
+func NewBlockRepository(db *sql.DB) BlockRepository {
+	return &blockRepository{db: db}
+}
+
+func (r *blockRepository) BlockUser(ctx context.Context, blockerID, blockedID string) error {
+	query := `INSERT INTO user_blocks(blocker_id, blocked_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+	_, err := r.db.ExecContext(ctx, query, blockerID, blockedID)
+	return dbError(err)
+}
+
+func (r *blockRepository) UnblockUser(ctx context.Context, blockerID, blockedID string) error {
+	query := `DELETE FROM user_blocks WHERE blocker_id = $1 AND blocked_id = $2`
+	_, err := r.db.ExecContext(ctx, query, blockerID, blockedID)
+	return dbError(err)
+}
+
+func (r *blockRepository) GetBlockedIDs(ctx context.Context, blockerID string) ([]string, error) {
+	query := `SELECT blocked_id FROM user_blocks WHERE blocker_id = $1`
+	rows, err := r.db.QueryContext(ctx, query, blockerID)
+	if err != nil {
+		return nil, dbError(err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, dbError(err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
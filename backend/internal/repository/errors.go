@@ -0,0 +1,36 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+
+	"github.com/kamdyns/movie-chat/internal/apperr"
+	"github.com/lib/pq"
+)
+
+// dbError translates database errors into apperr errors, keeping the
+// original as the cause. Anything it does not recognise is returned as is
+// and reported as internal.
+func dbError(err error) error {
+	var appErr *apperr.Error
+	if err == nil || errors.As(err, &appErr) {
+		return err
+	}
+
+	var pqErr *pq.Error
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return apperr.NotFound("not_found", "Not found").Wrap(err)
+	case errors.As(err, &pqErr) && pqErr.Code == "23505":
+		return apperr.Conflict("conflict", "Already exists").Wrap(err)
+	case errors.As(err, &pqErr) && pqErr.Code == "23503":
+		return apperr.NotFound("reference_not_found", "A referenced record does not exist").Wrap(err)
+	case errors.As(err, &pqErr) && pqErr.Code == "22P02":
+		return apperr.Validation("invalid_id", "Malformed ID").Wrap(err)
+	case errors.Is(err, driver.ErrBadConn), errors.Is(err, sql.ErrConnDone), errors.Is(err, context.DeadlineExceeded):
+		return apperr.Unavailable("database_unavailable", "The database is unavailable, please try again shortly", err)
+	}
+	return err
+}
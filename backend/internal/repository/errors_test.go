@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kamdyns/movie-chat/internal/apperr"
+	"github.com/lib/pq"
+)
+
+func TestDBError(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		err  error
+		kind apperr.Kind
+		code string
+	}{
+		{"no rows", sql.ErrNoRows, apperr.KindNotFound, "not_found"},
+		{"wrapped no rows", fmt.Errorf("get room: %w", sql.ErrNoRows), apperr.KindNotFound, "not_found"},
+		{"unique violation", &pq.Error{Code: "23505"}, apperr.KindConflict, "conflict"},
+		{"foreign key violation", &pq.Error{Code: "23503"}, apperr.KindNotFound, "reference_not_found"},
+		{"malformed uuid", &pq.Error{Code: "22P02"}, apperr.KindValidation, "invalid_id"},
+		{"bad connection", driver.ErrBadConn, apperr.KindUnavailable, "database_unavailable"},
+		{"timeout", context.DeadlineExceeded, apperr.KindUnavailable, "database_unavailable"},
+		{"other postgres error", &pq.Error{Code: "42601"}, apperr.KindInternal, "internal_error"},
+	} {
+		err := dbError(tc.err)
+		e := apperr.From(err)
+		if e.Kind != tc.kind || e.Code != tc.code {
+			t.Errorf("%s: got %v %q, want %v %q", tc.name, e.Kind, e.Code, tc.kind, tc.code)
+		}
+		if !errors.Is(err, tc.err) {
+			t.Errorf("%s: the cause was dropped", tc.name)
+		}
+	}
+}
+
+func TestDBErrorKeepsAppErrors(t *testing.T) {
+	if err := dbError(nil); err != nil {
+		t.Errorf("dbError(nil) = %v", err)
+	}
+	want := apperr.Gone("room_closed", "Room closed")
+	if err := dbError(want); err != want {
+		t.Errorf("dbError() = %v, want it unchanged", err)
+	}
+}
+
+// emptyDriver answers every query with no rows.
+type emptyDriver struct{}
+
+func (emptyDriver) Open(string) (driver.Conn, error) { return emptyConn{}, nil }
+
+type emptyConn struct{}
+
+func (emptyConn) Prepare(string) (driver.Stmt, error) { return emptyStmt{}, nil }
+func (emptyConn) Close() error                        { return nil }
+func (emptyConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+type emptyStmt struct{}
+
+func (emptyStmt) Close() error                               { return nil }
+func (emptyStmt) NumInput() int                              { return -1 }
+func (emptyStmt) Exec([]driver.Value) (driver.Result, error) { return driver.RowsAffected(0), nil }
+func (emptyStmt) Query([]driver.Value) (driver.Rows, error)  { return emptyRows{}, nil }
+
+type emptyRows struct{}
+
+func (emptyRows) Columns() []string              { return nil }
+func (emptyRows) Close() error                   { return nil }
+func (emptyRows) Next(dest []driver.Value) error { return io.EOF }
+
+func init() {
+	sql.Register("empty", emptyDriver{})
+}
+
+func TestGetRoomNotFound(t *testing.T) {
+	db, err := sql.Open("empty", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(apperr.Middleware())
+	r.GET("/rooms/:id", func(c *gin.Context) {
+		if _, err := NewRoomRepository(db).GetRoom(c, c.Param("id")); err != nil {
+			c.Error(err)
+		}
+	})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/rooms/missing", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status %d, want 404: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,153 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kamdyns/movie-chat/internal/model"
+	"github.com/lib/pq"
+)
+
+type HistoryRepository interface {
+	StartSession(ctx context.Context, roomID, userID string) (uuid.UUID, error)
+	EndSession(ctx context.Context, sessionID uuid.UUID) error
+	GetRoomActivity(ctx context.Context, userID string, from, to time.Time, limit, offset int) ([]model.RoomHistory, error)
+	CountRoomActivity(ctx context.Context, userID string, from, to time.Time) (int, error)
+	GetSessions(ctx context.Context, userID string, roomIDs []string, from, to time.Time) ([]model.RoomSession, error)
+	GetUserMessages(ctx context.Context, userID string, roomIDs []string, from, to time.Time, perRoom int) ([]model.Message, error)
+}
+
+type historyRepository struct {
+	db *sql.DB
+}
+
+func NewHistoryRepository(db *sql.DB) HistoryRepository {
+	return &historyRepository{db: db}
+}
+
+// activityQuery is every time the user joined a room, either by being added
+// as a member or by connecting to it.
+const activityQuery = `
+	WITH activity AS (
+		SELECT rm.room_id, rm.joined_at AS at
+		FROM room_members rm
+		JOIN users u ON u.id = rm.user_id
+		WHERE u.clerk_user_id = $1
+		UNION ALL
+		SELECT room_id, joined_at AS at
+		FROM room_sessions
+		WHERE user_id = $1
+	)
+`
+
+func (r *historyRepository) StartSession(ctx context.Context, roomID, userID string) (uuid.UUID, error) {
+	query := `INSERT INTO room_sessions(room_id, user_id) VALUES ($1, $2) RETURNING id`
+	var id uuid.UUID
+	err := r.db.QueryRowContext(ctx, query, roomID, userID).Scan(&id)
+	return id, dbError(err)
+}
+
+func (r *historyRepository) EndSession(ctx context.Context, sessionID uuid.UUID) error {
+	query := `UPDATE room_sessions SET left_at = NOW() WHERE id = $1 AND left_at IS NULL`
+	_, err := r.db.ExecContext(ctx, query, sessionID)
+	return dbError(err)
+}
+
+func (r *historyRepository) GetRoomActivity(ctx context.Context, userID string, from, to time.Time, limit, offset int) ([]model.RoomHistory, error) {
+	query := activityQuery + `
+		SELECT r.id, r.name, r.movie_title, MIN(a.at), MAX(a.at)
+		FROM activity a
+		JOIN rooms r ON r.id = a.room_id
+		WHERE a.at >= $2 AND a.at < $3
+		GROUP BY r.id, r.name, r.movie_title
+		ORDER BY MAX(a.at) DESC
+		LIMIT $4 OFFSET $5
+	`
+	rows, err := r.db.QueryContext(ctx, query, userID, from, to, limit, offset)
+	if err != nil {
+		return nil, dbError(err)
+	}
+	defer rows.Close()
+
+	history := []model.RoomHistory{}
+	for rows.Next() {
+		var h model.RoomHistory
+		if err := rows.Scan(&h.RoomID, &h.RoomName, &h.MovieTitle, &h.FirstJoinedAt, &h.LastJoinedAt); err != nil {
+			return nil, dbError(err)
+		}
+		history = append(history, h)
+	}
+	return history, rows.Err()
+}
+
+func (r *historyRepository) CountRoomActivity(ctx context.Context, userID string, from, to time.Time) (int, error) {
+	query := activityQuery + `
+		SELECT COUNT(DISTINCT room_id)
+		FROM activity
+		WHERE at >= $2 AND at < $3
+	`
+	var count int
+	err := r.db.QueryRowContext(ctx, query, userID, from, to).Scan(&count)
+	return count, dbError(err)
+}
+
+// GetSessions returns the user's sessions in the given rooms, oldest first.
+// Sessions still open are measured up to now.
+func (r *historyRepository) GetSessions(ctx context.Context, userID string, roomIDs []string, from, to time.Time) ([]model.RoomSession, error) {
+	query := `
+		SELECT id, room_id, user_id, joined_at, left_at,
+			EXTRACT(EPOCH FROM COALESCE(left_at, NOW()) - joined_at)::BIGINT
+		FROM room_sessions
+		WHERE user_id = $1 AND room_id = ANY($2::uuid[]) AND joined_at >= $3 AND joined_at < $4
+		ORDER BY joined_at
+	`
+	rows, err := r.db.QueryContext(ctx, query, userID, pq.Array(roomIDs), from, to)
+	if err != nil {
+		return nil, dbError(err)
+	}
+	defer rows.Close()
+
+	var sessions []model.RoomSession
+	for rows.Next() {
+		var s model.RoomSession
+		if err := rows.Scan(&s.ID, &s.RoomID, &s.UserID, &s.JoinedAt, &s.LeftAt, &s.DurationSeconds); err != nil {
+			return nil, dbError(err)
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+// GetUserMessages returns up to perRoom of the user's most recent messages
+// in each of the given rooms, newest first.
+func (r *historyRepository) GetUserMessages(ctx context.Context, userID string, roomIDs []string, from, to time.Time, perRoom int) ([]model.Message, error) {
+	query := `
+		SELECT id, room_id, clerk_user_id, username, content, created_at
+		FROM (
+			SELECT m.id, m.room_id, u.clerk_user_id, u.username, m.content, m.created_at,
+				ROW_NUMBER() OVER (PARTITION BY m.room_id ORDER BY m.created_at DESC) AS n
+			FROM messages m
+			JOIN users u ON u.id = m.user_id
+			WHERE u.clerk_user_id = $1 AND m.room_id = ANY($2::uuid[]) AND m.created_at >= $3 AND m.created_at < $4
+		) ranked
+		WHERE n <= $5
+		ORDER BY created_at DESC
+	`
+	rows, err := r.db.QueryContext(ctx, query, userID, pq.Array(roomIDs), from, to, perRoom)
+	if err != nil {
+		return nil, dbError(err)
+	}
+	defer rows.Close()
+
+	var messages []model.Message
+	for rows.Next() {
+		var m model.Message
+		if err := rows.Scan(&m.ID, &m.RoomID, &m.UserID, &m.Username, &m.Content, &m.CreatedAt); err != nil {
+			return nil, dbError(err)
+		}
+		messages = append(messages, m)
+	}
+	return messages, rows.Err()
+}
@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/kamdyns/movie-chat/internal/model"
+)
+
+type MessageRepository interface {
+	CreateMessage(ctx context.Context, msg *model.Message) (*model.Message, error)
+	GetRoomMessages(ctx context.Context, roomID, viewerID string, before time.Time, limit int) ([]model.Message, error)
+	GetMessagesAfter(ctx context.Context, roomID string, afterSeq int64, limit int) ([]model.Message, error)
+	GetLastSeq(ctx context.Context, roomID string) (int64, error)
+}
+
+type messageRepository struct {
+	db *sql.DB
+}
+
+func NewMessageRepository(db *sql.DB) MessageRepository {
+	return &messageRepository{db: db}
+}
+
+func (r *messageRepository) CreateMessage(ctx context.Context, msg *model.Message) (*model.Message, error) {
+	query := `
+		INSERT INTO messages(room_id, user_id, content, created_at, seq)
+		SELECT $1, id, $3, $4, NULLIF($5, 0) FROM users WHERE clerk_user_id = $2
+		RETURNING id
+	`
+	err := r.db.QueryRowContext(ctx, query, msg.RoomID, msg.UserID, msg.Content, msg.CreatedAt, msg.Seq).Scan(&msg.ID)
+	if err != nil {
+		return nil, dbError(err)
+	}
+	return msg, nil
+}
+
+// GetRoomMessages returns a page of a room's messages older than before,
+// newest first, leaving out messages from anyone the viewer has blocked.
+func (r *messageRepository) GetRoomMessages(ctx context.Context, roomID, viewerID string, before time.Time, limit int) ([]model.Message, error) {
+	query := `
+		SELECT m.id, COALESCE(m.seq, 0), m.room_id, u.clerk_user_id, u.username, m.content, m.created_at
+		FROM messages m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.room_id = $1
+		  AND m.created_at < $3
+		  AND NOT EXISTS (
+			SELECT 1 FROM user_blocks b
+			WHERE b.blocker_id = $2 AND b.blocked_id = u.clerk_user_id
+		  )
+		ORDER BY m.created_at DESC
+		LIMIT $4
+	`
+	rows, err := r.db.QueryContext(ctx, query, roomID, viewerID, before, limit)
+	if err != nil {
+		return nil, dbError(err)
+	}
+	defer rows.Close()
+
+	messages := []model.Message{}
+	for rows.Next() {
+		var m model.Message
+		if err := rows.Scan(&m.ID, &m.Seq, &m.RoomID, &m.UserID, &m.Username, &m.Content, &m.CreatedAt); err != nil {
+			return nil, dbError(err)
+		}
+		messages = append(messages, m)
+	}
+	return messages, rows.Err()
+}
+
+// GetMessagesAfter returns up to limit of a room's messages numbered after
+// afterSeq, oldest first. Blocks are left to the caller.
+func (r *messageRepository) GetMessagesAfter(ctx context.Context, roomID string, afterSeq int64, limit int) ([]model.Message, error) {
+	query := `
+		SELECT m.id, m.seq, m.room_id, u.clerk_user_id, u.username, m.content, m.created_at
+		FROM messages m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.room_id = $1 AND m.seq > $2
+		ORDER BY m.seq
+		LIMIT $3
+	`
+	rows, err := r.db.QueryContext(ctx, query, roomID, afterSeq, limit)
+	if err != nil {
+		return nil, dbError(err)
+	}
+	defer rows.Close()
+
+	messages := []model.Message{}
+	for rows.Next() {
+		var m model.Message
+		if err := rows.Scan(&m.ID, &m.Seq, &m.RoomID, &m.UserID, &m.Username, &m.Content, &m.CreatedAt); err != nil {
+			return nil, dbError(err)
+		}
+		messages = append(messages, m)
+	}
+	return messages, rows.Err()
+}
+
+// GetLastSeq returns the highest number given to a stored message of the
+// room, or zero if there is none.
+func (r *messageRepository) GetLastSeq(ctx context.Context, roomID string) (int64, error) {
+	var seq int64
+	err := r.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(seq), 0) FROM messages WHERE room_id = $1`, roomID).Scan(&seq)
+	if err != nil {
+		return 0, dbError(err)
+	}
+	return seq, nil
+}
@@ -14,9 +14,11 @@ type RoomRepository interface {
 	GetTotalRoomCount(ctx context.Context) (int, error)
 	UpdateRoom(ctx context.Context, room *model.Room) (*model.Room, error)
 	DeleteRoom(ctx context.Context, id string) error
-	AddMember(ctx context.Context, roomID string, userID int64) error
-	RemoveMember(ctx context.Context, roomID string, userID int64) error
+	AddMember(ctx context.Context, roomID, clerkUserID string) error
+	RemoveMember(ctx context.Context, roomID, clerkUserID string) error
 	GetRoomMembers(ctx context.Context, roomID string) ([]*model.RoomMember, error)
+	IsMember(ctx context.Context, roomID, clerkUserID string) (bool, error)
+	UpdateRoomModes(ctx context.Context, roomID string, modes model.RoomModes) error
 }
 
 type roomRepository struct {
@@ -28,27 +30,32 @@ func NewRoomRepository(db *sql.DB) RoomRepository {
 }
 
 func (r *roomRepository) CreateRoom(ctx context.Context, room *model.Room) (*model.Room, error) {
-	query := `INSERT INTO rooms(id, name, created_by, created_at, expires_at) VALUES ($1, $2, $3, $4, $5) RETURNING id, name, created_by, created_at, expires_at`
-	err := r.db.QueryRowContext(ctx, query, room.ID, room.Name, room.CreatedBy, room.CreatedAt, room.ExpiresAt).Scan(&room.ID, &room.Name, &room.CreatedBy, &room.CreatedAt, &room.ExpiresAt)
+	query := `INSERT INTO rooms(id, name, movie_title, created_by, created_at, expires_at) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, name, movie_title, created_by, created_at, expires_at`
+	err := r.db.QueryRowContext(ctx, query, room.ID, room.Name, room.MovieTitle, room.CreatedBy, room.CreatedAt, room.ExpiresAt).Scan(&room.ID, &room.Name, &room.MovieTitle, &room.CreatedBy, &room.CreatedAt, &room.ExpiresAt)
 	if err != nil {
-		return nil, err
+		return nil, dbError(err)
 	}
 	return room, nil
 }
 
 func (r *roomRepository) GetRoom(ctx context.Context, id string) (*model.Room, error) {
-	query := `SELECT id, name FROM rooms WHERE id = $1`
+	query := `
+		SELECT id, name, movie_title, created_by, created_at, expires_at, closed_at, slow_mode_seconds, members_only, emoji_only
+		FROM rooms
+		WHERE id = $1
+	`
 	var room model.Room
-	err := r.db.QueryRowContext(ctx, query, id).Scan(&room.ID, &room.Name)
+	err := r.db.QueryRowContext(ctx, query, id).Scan(&room.ID, &room.Name, &room.MovieTitle, &room.CreatedBy, &room.CreatedAt, &room.ExpiresAt, &room.ClosedAt,
+		&room.Modes.SlowModeSeconds, &room.Modes.MembersOnly, &room.Modes.EmojiOnly)
 	if err != nil {
-		return nil, err
+		return nil, dbError(err)
 	}
 	return &room, nil
 }
 
 func (r *roomRepository) GetRooms(ctx context.Context, limit, offset int) ([]model.Room, error) {
 	query := `
-		SELECT id, name, created_by, created_at, expires_at 
+		SELECT id, name, movie_title, created_by, created_at, expires_at
 		FROM rooms 
 		WHERE expires_at > NOW() 
 		ORDER BY created_at DESC 
@@ -56,15 +63,15 @@ func (r *roomRepository) GetRooms(ctx context.Context, limit, offset int) ([]mod
 	`
 	rows, err := r.db.QueryContext(ctx, query, limit, offset)
 	if err != nil {
-		return nil, err
+		return nil, dbError(err)
 	}
 	defer rows.Close()
 
 	var rooms []model.Room
 	for rows.Next() {
 		var room model.Room
-		if err := rows.Scan(&room.ID, &room.Name, &room.CreatedBy, &room.CreatedAt, &room.ExpiresAt); err != nil {
-			return nil, err
+		if err := rows.Scan(&room.ID, &room.Name, &room.MovieTitle, &room.CreatedBy, &room.CreatedAt, &room.ExpiresAt); err != nil {
+			return nil, dbError(err)
 		}
 		rooms = append(rooms, room)
 	}
@@ -76,14 +83,14 @@ func (r *roomRepository) GetTotalRoomCount(ctx context.Context) (int, error) {
 	var count int
 	query := "SELECT COUNT(*) FROM rooms WHERE expires_at > NOW()"
 	err := r.db.QueryRowContext(ctx, query).Scan(&count)
-	return count, err
+	return count, dbError(err)
 }
 
 func (r *roomRepository) UpdateRoom(ctx context.Context, room *model.Room) (*model.Room, error) {
-	query := `UPDATE rooms SET name = $2 WHERE id = $1`
-	_, err := r.db.ExecContext(ctx, query, room.ID, room.Name)
+	query := `UPDATE rooms SET name = $2, movie_title = $3, expires_at = $4 WHERE id = $1`
+	_, err := r.db.ExecContext(ctx, query, room.ID, room.Name, room.MovieTitle, room.ExpiresAt)
 	if err != nil {
-		return nil, err
+		return nil, dbError(err)
 	}
 	return room, nil
 }
@@ -92,44 +99,84 @@ func (r *roomRepository) DeleteRoom(ctx context.Context, id string) error {
 	query := `DELETE FROM rooms WHERE id = $1`
 	_, err := r.db.ExecContext(ctx, query, id)
 	if err != nil {
-		return err
+		return dbError(err)
 	}
 	return nil
 }
 
-func (r *roomRepository) AddMember(ctx context.Context, roomID string, userID int64) error {
-	query := `INSERT INTO room_members(room_id, user_id) VALUES ($1, $2)`
-	_, err := r.db.ExecContext(ctx, query, roomID, userID)
-	if err != nil {
-		return err
+// AddMember adds a user to a room. Adding an existing member does nothing.
+// It returns sql.ErrNoRows if the user does not exist.
+func (r *roomRepository) AddMember(ctx context.Context, roomID, clerkUserID string) error {
+	query := `
+		WITH u AS (
+			SELECT id FROM users WHERE clerk_user_id = $2 AND deleted_at IS NULL
+		), ins AS (
+			INSERT INTO room_members(room_id, user_id)
+			SELECT $1, id FROM u
+			ON CONFLICT (room_id, user_id) DO NOTHING
+		)
+		SELECT EXISTS (SELECT 1 FROM u)
+	`
+	var found bool
+	if err := r.db.QueryRowContext(ctx, query, roomID, clerkUserID).Scan(&found); err != nil {
+		return dbError(err)
+	}
+	if !found {
+		return dbError(sql.ErrNoRows)
 	}
 	return nil
 }
 
-func (r *roomRepository) RemoveMember(ctx context.Context, roomID string, userID int64) error {
-	query := `DELETE FROM room_members WHERE room_id = $1 AND user_id = $2`
-	_, err := r.db.ExecContext(ctx, query, roomID, userID)
-	if err != nil {
-		return err
-	}
-	return nil
+func (r *roomRepository) RemoveMember(ctx context.Context, roomID, clerkUserID string) error {
+	query := `
+		DELETE FROM room_members
+		WHERE room_id = $1 AND user_id = (SELECT id FROM users WHERE clerk_user_id = $2)
+	`
+	_, err := r.db.ExecContext(ctx, query, roomID, clerkUserID)
+	return dbError(err)
 }
 
 func (r *roomRepository) GetRoomMembers(ctx context.Context, roomID string) ([]*model.RoomMember, error) {
-	query := `SELECT id, room_id, user_id, joined_at FROM room_members WHERE room_id = $1`
+	query := `
+		SELECT rm.room_id, u.clerk_user_id, u.username, rm.joined_at
+		FROM room_members rm
+		JOIN users u ON u.id = rm.user_id
+		WHERE rm.room_id = $1
+		ORDER BY rm.joined_at
+	`
 	rows, err := r.db.QueryContext(ctx, query, roomID)
 	if err != nil {
-		return nil, err
+		return nil, dbError(err)
 	}
 	defer rows.Close()
 
-	var members []*model.RoomMember
+	members := []*model.RoomMember{}
 	for rows.Next() {
 		member := &model.RoomMember{}
-		if err := rows.Scan(&member.ID, &member.RoomID, &member.UserID, &member.JoinedAt); err != nil {
-			return nil, err
+		if err := rows.Scan(&member.RoomID, &member.UserID, &member.Username, &member.JoinedAt); err != nil {
+			return nil, dbError(err)
 		}
 		members = append(members, member)
 	}
 	return members, nil
 }
+
+func (r *roomRepository) IsMember(ctx context.Context, roomID, clerkUserID string) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1
+			FROM room_members rm
+			JOIN users u ON u.id = rm.user_id
+			WHERE rm.room_id = $1 AND u.clerk_user_id = $2
+		)
+	`
+	var isMember bool
+	err := r.db.QueryRowContext(ctx, query, roomID, clerkUserID).Scan(&isMember)
+	return isMember, dbError(err)
+}
+
+func (r *roomRepository) UpdateRoomModes(ctx context.Context, roomID string, modes model.RoomModes) error {
+	query := `UPDATE rooms SET slow_mode_seconds = $2, members_only = $3, emoji_only = $4 WHERE id = $1`
+	_, err := r.db.ExecContext(ctx, query, roomID, modes.SlowModeSeconds, modes.MembersOnly, modes.EmojiOnly)
+	return dbError(err)
+}
@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/kamdyns/movie-chat/internal/model"
+)
+
+type SessionRepository interface {
+	UpsertSession(ctx context.Context, session *model.Session) error
+	EndSession(ctx context.Context, id, status string) error
+	GetSession(ctx context.Context, id string) (*model.Session, error)
+}
+
+type sessionRepository struct {
+	db *sql.DB
+}
+
+func NewSessionRepository(db *sql.DB) SessionRepository {
+	return &sessionRepository{db: db}
+}
+
+func (r *sessionRepository) UpsertSession(ctx context.Context, session *model.Session) error {
+	query := `
+		INSERT INTO clerk_sessions(id, user_id, status) VALUES ($1, $2, $3)
+		ON CONFLICT (id) DO UPDATE SET status = EXCLUDED.status
+	`
+	_, err := r.db.ExecContext(ctx, query, session.ID, session.UserID, session.Status)
+	return dbError(err)
+}
+
+func (r *sessionRepository) EndSession(ctx context.Context, id, status string) error {
+	query := `UPDATE clerk_sessions SET status = $2, ended_at = COALESCE(ended_at, NOW()) WHERE id = $1`
+	_, err := r.db.ExecContext(ctx, query, id, status)
+	return dbError(err)
+}
+
+func (r *sessionRepository) GetSession(ctx context.Context, id string) (*model.Session, error) {
+	query := `SELECT id, user_id, status, created_at, ended_at FROM clerk_sessions WHERE id = $1`
+	session := &model.Session{}
+	err := r.db.QueryRowContext(ctx, query, id).Scan(&session.ID, &session.UserID, &session.Status, &session.CreatedAt, &session.EndedAt)
+	if err != nil {
+		return nil, dbError(err)
+	}
+	return session, nil
+}
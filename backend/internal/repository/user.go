@@ -3,14 +3,19 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 
 	"github.com/kamdyns/movie-chat/internal/model"
+	"github.com/lib/pq"
 )
 
 type UserRepository interface {
 	CreateUser(ctx context.Context, user *model.User) (*model.User, error)
+	ProvisionUser(ctx context.Context, user *model.User) (*model.User, error)
 	GetUserByClerkID(ctx context.Context, clerkUserID string) (*model.User, error)
 	UpdateUser(ctx context.Context, user *model.User) error
+	GetProfile(ctx context.Context, clerkUserID string) (*model.UserProfile, error)
+	UpdateProfile(ctx context.Context, profile *model.UserProfile) error
 }
 
 type userRepository struct {
@@ -21,21 +26,45 @@ func NewUserRepository(db *sql.DB) UserRepository {
 	return &userRepository{db: db}
 }
 
+// CreateUser stores a user Clerk told us about, updating the row if it
+// exists. Deleted accounts are not created again; they return not found.
 func (r *userRepository) CreateUser(ctx context.Context, user *model.User) (*model.User, error) {
-	query := `INSERT INTO users(clerk_user_id, username, email) VALUES ($1, $2, $3) RETURNING id`
+	query := `
+		INSERT INTO users(clerk_user_id, username, email)
+		SELECT $1, $2, $3
+		WHERE NOT EXISTS (SELECT 1 FROM deleted_accounts WHERE clerk_user_id = $1)
+		ON CONFLICT (clerk_user_id) DO UPDATE SET username = EXCLUDED.username, email = EXCLUDED.email
+		RETURNING id
+	`
 	err := r.db.QueryRowContext(ctx, query, user.ClerkUserID, user.Username, user.Email).Scan(&user.ID)
 	if err != nil {
-		return nil, err
+		return nil, dbError(err)
 	}
 	return user, nil
 }
 
+// ProvisionUser inserts a placeholder row for a user the webhook has not
+// told us about yet. It never overwrites a row that already exists, and
+// returns whichever row ends up stored, or not found for a deleted account.
+func (r *userRepository) ProvisionUser(ctx context.Context, user *model.User) (*model.User, error) {
+	query := `
+		INSERT INTO users(clerk_user_id, username, email)
+		SELECT $1, $2, $3
+		WHERE NOT EXISTS (SELECT 1 FROM deleted_accounts WHERE clerk_user_id = $1)
+		ON CONFLICT (clerk_user_id) DO NOTHING
+	`
+	if _, err := r.db.ExecContext(ctx, query, user.ClerkUserID, user.Username, user.Email); err != nil {
+		return nil, dbError(err)
+	}
+	return r.GetUserByClerkID(ctx, user.ClerkUserID)
+}
+
 func (r *userRepository) GetUserByClerkID(ctx context.Context, clerkUserID string) (*model.User, error) {
 	user := &model.User{}
-	query := `SELECT id, clerk_user_id, username, email FROM users WHERE clerk_user_id = $1`
-	err := r.db.QueryRowContext(ctx, query, clerkUserID).Scan(&user.ID, &user.ClerkUserID, &user.Username, &user.Email)
+	query := `SELECT id, clerk_user_id, username, email, role, suspended_at FROM users WHERE clerk_user_id = $1`
+	err := r.db.QueryRowContext(ctx, query, clerkUserID).Scan(&user.ID, &user.ClerkUserID, &user.Username, &user.Email, &user.Role, &user.SuspendedAt)
 	if err != nil {
-		return nil, err
+		return nil, dbError(err)
 	}
 	return user, nil
 }
@@ -43,5 +72,43 @@ func (r *userRepository) GetUserByClerkID(ctx context.Context, clerkUserID strin
 func (r *userRepository) UpdateUser(ctx context.Context, user *model.User) error {
 	query := `UPDATE users SET username = $1, email = $2 WHERE clerk_user_id = $3`
 	_, err := r.db.ExecContext(ctx, query, user.Username, user.Email, user.ClerkUserID)
-	return err
+	return dbError(err)
+}
+
+func (r *userRepository) GetProfile(ctx context.Context, clerkUserID string) (*model.UserProfile, error) {
+	query := `
+		SELECT clerk_user_id, username, display_name, avatar_url, bio, favorite_genres, notification_preferences, created_at
+		FROM users
+		WHERE clerk_user_id = $1
+	`
+	profile := &model.UserProfile{NotificationPreferences: &model.NotificationPreferences{}}
+	var prefs []byte
+	err := r.db.QueryRowContext(ctx, query, clerkUserID).Scan(&profile.UserID, &profile.Username, &profile.DisplayName,
+		&profile.AvatarURL, &profile.Bio, pq.Array(&profile.FavoriteGenres), &prefs, &profile.CreatedAt)
+	if err != nil {
+		return nil, dbError(err)
+	}
+	if err := json.Unmarshal(prefs, profile.NotificationPreferences); err != nil {
+		return nil, dbError(err)
+	}
+	if profile.FavoriteGenres == nil {
+		profile.FavoriteGenres = []string{}
+	}
+	return profile, nil
+}
+
+func (r *userRepository) UpdateProfile(ctx context.Context, profile *model.UserProfile) error {
+	prefs, err := json.Marshal(profile.NotificationPreferences)
+	if err != nil {
+		return dbError(err)
+	}
+
+	query := `
+		UPDATE users
+		SET display_name = $2, avatar_url = $3, bio = $4, favorite_genres = $5, notification_preferences = $6
+		WHERE clerk_user_id = $1
+	`
+	_, err = r.db.ExecContext(ctx, query, profile.UserID, profile.DisplayName, profile.AvatarURL, profile.Bio,
+		pq.Array(profile.FavoriteGenres), prefs)
+	return dbError(err)
 }
@@ -0,0 +1,32 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+)
+
+type WebhookRepository interface {
+	IsProcessed(ctx context.Context, eventID string) (bool, error)
+	MarkProcessed(ctx context.Context, eventID, eventType string) error
+}
+
+type webhookRepository struct {
+	db *sql.DB
+}
+
+func NewWebhookRepository(db *sql.DB) WebhookRepository {
+	return &webhookRepository{db: db}
+}
+
+func (r *webhookRepository) IsProcessed(ctx context.Context, eventID string) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM webhook_events WHERE id = $1)`
+	var processed bool
+	err := r.db.QueryRowContext(ctx, query, eventID).Scan(&processed)
+	return processed, dbError(err)
+}
+
+func (r *webhookRepository) MarkProcessed(ctx context.Context, eventID, eventType string) error {
+	query := `INSERT INTO webhook_events(id, type) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+	_, err := r.db.ExecContext(ctx, query, eventID, eventType)
+	return dbError(err)
+}
@@ -1,31 +1,64 @@
 package server
 
 import (
+	"context"
 	"database/sql"
+	"expvar"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/clerkinc/clerk-sdk-go/clerk"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 
+	"github.com/kamdyns/movie-chat/internal/apperr"
+	"github.com/kamdyns/movie-chat/internal/auth"
+	"github.com/kamdyns/movie-chat/internal/backplane"
 	"github.com/kamdyns/movie-chat/internal/config"
+	"github.com/kamdyns/movie-chat/internal/filter"
 	"github.com/kamdyns/movie-chat/internal/handler"
+	"github.com/kamdyns/movie-chat/internal/ratelimit"
 	"github.com/kamdyns/movie-chat/internal/repository"
 	"github.com/kamdyns/movie-chat/internal/service"
+	"github.com/kamdyns/movie-chat/internal/webhook"
 	"github.com/kamdyns/movie-chat/internal/websocket"
 	"github.com/kamdyns/movie-chat/pkg/database"
+	"github.com/redis/go-redis/v9"
 )
 
 type Server struct {
-	config      *config.Config
-	db          *sql.DB
-	router      *gin.Engine
-	userRepo    repository.UserRepository
-	roomRepo    repository.RoomRepository
-	userService service.UserService
-	roomService service.RoomService
-	wsHub       *websocket.Hub
-	clerkClient clerk.Client
+	config         *config.Config
+	db             *sql.DB
+	router         *gin.Engine
+	userRepo       repository.UserRepository
+	roomRepo       repository.RoomRepository
+	blockRepo      repository.BlockRepository
+	messageRepo    repository.MessageRepository
+	historyRepo    repository.HistoryRepository
+	sessionRepo    repository.SessionRepository
+	webhookRepo    repository.WebhookRepository
+	accountRepo    repository.AccountRepository
+	adminRepo      repository.AdminRepository
+	userService    service.UserService
+	roomService    service.RoomService
+	blockService   service.BlockService
+	messageService service.MessageService
+	historyService service.HistoryService
+	accountService service.AccountService
+	adminService   service.AdminService
+	wsHub          *websocket.Hub
+	authenticator  auth.Authenticator
+	tickets        *auth.TicketStore
+	origins        *auth.Origins
+	verifier       *webhook.Verifier
+
+	// websockets tracks /ws requests, which http.Server.Shutdown does not
+	// wait for once they have been hijacked.
+	websockets sync.WaitGroup
 }
 
 func NewServer(cfg *config.Config) (*Server, error) {
@@ -36,41 +69,125 @@ func NewServer(cfg *config.Config) (*Server, error) {
 
 	userRepo := repository.NewUserRepository(db)
 	roomRepo := repository.NewRoomRepository(db)
+	blockRepo := repository.NewBlockRepository(db)
+	messageRepo := repository.NewMessageRepository(db)
+	historyRepo := repository.NewHistoryRepository(db)
+	sessionRepo := repository.NewSessionRepository(db)
+	webhookRepo := repository.NewWebhookRepository(db)
+	accountRepo := repository.NewAccountRepository(db, userRepo)
+	adminRepo := repository.NewAdminRepository(db)
 
-	userService := service.NewUserService(userRepo)
-	roomService := service.NewRoomService(roomRepo)
+	accountService := service.NewAccountService(accountRepo, cfg.UserDeletionPolicy)
+	userService := service.NewUserService(userRepo, sessionRepo, webhookRepo, accountService)
+	roomService := service.NewRoomService(roomRepo, service.RoomPolicy{
+		MinLifetime: cfg.RoomMinLifetime,
+		MaxLifetime: cfg.RoomMaxLifetime,
+	})
+	blockService := service.NewBlockService(blockRepo, userRepo)
+	messageService := service.NewMessageService(messageRepo)
+	historyService := service.NewHistoryService(historyRepo)
+	adminService := service.NewAdminService(adminRepo)
 
-	wsHub := websocket.NewHub()
+	authenticator, err := newAuthenticator(cfg)
+	if err != nil {
+		return nil, err
+	}
 
-	clerkClient, err := clerk.NewClient(cfg.ClerkPublicKey)
+	bp, err := newBackplane(cfg, db, messageService.LastSeq)
 	if err != nil {
 		return nil, err
 	}
 
+	tickets, err := newTicketBackend(cfg, db)
+	if err != nil {
+		return nil, err
+	}
+
+	wsHub := websocket.NewHub(websocket.Options{
+		Rooms:    roomService,
+		Messages: messageService,
+		Filters:  newMessageFilters(cfg),
+		Limits: websocket.RateLimits{
+			ClientRate:    cfg.WSMessageRate,
+			ClientBurst:   cfg.WSMessageBurst,
+			RoomRate:      cfg.RoomMessageRate,
+			RoomBurst:     cfg.RoomMessageBurst,
+			MaxViolations: cfg.WSMaxViolations,
+		},
+		Auth:        authenticator,
+		ExpiryGrace: cfg.WSExpiryGrace,
+		Backplane:   bp,
+		Shards:      cfg.HubShards,
+		SendBuffer:  cfg.WSSendBuffer,
+		SlowConsumers: websocket.SlowConsumerPolicy{
+			Action:     cfg.SlowConsumerPolicy,
+			MaxDropped: cfg.SlowConsumerDrops,
+		},
+		KeepAlive: websocket.KeepAlive{
+			PingInterval:   cfg.WSPingInterval,
+			PongWait:       cfg.WSPongWait,
+			WriteWait:      cfg.WSWriteWait,
+			MaxMessageSize: int64(cfg.WSMaxMessageSize),
+		},
+		ReplayBuffer:    cfg.WSReplayBuffer,
+		IdleRoomTimeout: cfg.WSIdleRoomTimeout,
+		ReconnectJitter: cfg.WSReconnectJitter,
+	})
+
+	// Without a signing secret there is no way to trust Clerk webhooks, so
+	// the route is left out. That is expected when running without Clerk.
+	var verifier *webhook.Verifier
+	if cfg.ClerkWebhookSecret != "" {
+		verifier, err = webhook.NewVerifier(cfg.ClerkWebhookSecret, cfg.WebhookTolerance)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		log.Printf("CLERK_WEBHOOK_SECRET is not set, /webhook is disabled")
+	}
+
 	router := gin.Default()
 
+	origins, err := auth.NewOrigins(cfg.AllowedOrigins)
+	if err != nil {
+		return nil, err
+	}
 	router.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"http://localhost:3000"},
-		AllowMethods:     []string{"GET", "POST"},
-		AllowHeaders:     []string{"Content-Type"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowOriginFunc:  origins.Allow,
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Content-Type", "Authorization", "X-Request-ID"},
+		ExposeHeaders:    []string{"Content-Length", "Deprecation", "Link", "Retry-After", "X-Request-ID"},
 		AllowCredentials: true,
-		AllowOriginFunc: func(origin string) bool {
-			return origin == "http://localhost:3000"
-		},
-		MaxAge: 12 * time.Hour,
+		MaxAge:           12 * time.Hour,
 	}))
+	router.Use(apperr.RequestID())
+	router.Use(apperr.Middleware())
 
 	server := &Server{
-		config:      cfg,
-		db:          db,
-		router:      router,
-		userRepo:    userRepo,
-		roomRepo:    roomRepo,
-		userService: userService,
-		roomService: roomService,
-		wsHub:       wsHub,
-		clerkClient: clerkClient,
+		config:         cfg,
+		db:             db,
+		router:         router,
+		userRepo:       userRepo,
+		roomRepo:       roomRepo,
+		blockRepo:      blockRepo,
+		messageRepo:    messageRepo,
+		historyRepo:    historyRepo,
+		sessionRepo:    sessionRepo,
+		webhookRepo:    webhookRepo,
+		accountRepo:    accountRepo,
+		adminRepo:      adminRepo,
+		userService:    userService,
+		roomService:    roomService,
+		blockService:   blockService,
+		messageService: messageService,
+		historyService: historyService,
+		accountService: accountService,
+		adminService:   adminService,
+		wsHub:          wsHub,
+		authenticator:  authenticator,
+		tickets:        auth.NewTicketStore(cfg.WSTicketTTL, tickets),
+		origins:        origins,
+		verifier:       verifier,
 	}
 
 	server.setupRoutes()
@@ -78,47 +195,236 @@ func NewServer(cfg *config.Config) (*Server, error) {
 	return server, nil
 }
 
+// newAuthenticator picks how session tokens are verified. Clerk is the
+// default; jwks accepts any OIDC provider and dev accepts locally minted
+// tokens for offline development and tests.
+func newAuthenticator(cfg *config.Config) (auth.Authenticator, error) {
+	switch cfg.AuthProvider {
+	case auth.ProviderClerk:
+		clerkClient, err := clerk.NewClient(cfg.ClerkPublicKey)
+		if err != nil {
+			return nil, err
+		}
+		return auth.NewClerkAuthenticator(clerkClient), nil
+	case auth.ProviderJWKS:
+		return auth.NewJWKSAuthenticator(cfg.JWKSURL, cfg.OIDCIssuer, cfg.OIDCAudience)
+	case auth.ProviderDev:
+		log.Printf("using dev authentication, do not run this in production")
+		return auth.NewDevAuthenticator(cfg.DevAuthSecret)
+	default:
+		return nil, fmt.Errorf("unknown auth provider %q", cfg.AuthProvider)
+	}
+}
+
+// newBackplane picks how instances share rooms. The default keeps every
+// room on this instance; postgres and redis let several instances run
+// behind a load balancer. Rooms are numbered by ID, and seed picks up from
+// the stored messages so numbers keep increasing across restarts.
+func newBackplane(cfg *config.Config, db *sql.DB, seed backplane.Seed) (backplane.Backplane, error) {
+	switch cfg.Backplane {
+	case backplane.ProviderLocal:
+		return backplane.NewLocal(seed), nil
+	case backplane.ProviderPostgres:
+		return backplane.NewPostgres(db, database.ConnString(), seed), nil
+	case backplane.ProviderRedis:
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return backplane.NewRedis(ctx, cfg.RedisURL, seed)
+	default:
+		return nil, fmt.Errorf("unknown backplane %q", cfg.Backplane)
+	}
+}
+
+// newTicketBackend keeps websocket tickets wherever the backplane shares
+// rooms, so instances that share rooms also accept each other's tickets.
+func newTicketBackend(cfg *config.Config, db *sql.DB) (auth.TicketBackend, error) {
+	switch cfg.Backplane {
+	case backplane.ProviderPostgres:
+		return auth.NewPostgresTickets(db), nil
+	case backplane.ProviderRedis:
+		opts, err := redis.ParseURL(cfg.RedisURL)
+		if err != nil {
+			return nil, err
+		}
+		return auth.NewRedisTickets(redis.NewClient(opts)), nil
+	default:
+		return auth.NewMemoryTickets(), nil
+	}
+}
+
+// newMessageFilters builds the chain every chat message passes through before
+// it is broadcast. Cheap checks run first so spam is rejected early.
+func newMessageFilters(cfg *config.Config) *filter.Chain {
+	return filter.NewChain(
+		filter.NewMaxLength(cfg.MaxMessageLength),
+		filter.NewDuplicateFilter(cfg.DuplicateWindow, cfg.DuplicateLimit),
+		filter.NewLinkPolicy(cfg.LinkPolicy, cfg.AllowedLinkDomains, cfg.DeniedLinkDomains),
+		filter.NewWordFilter(cfg.BlockedWords, cfg.BlockedWordAction),
+	)
+}
+
 func (s *Server) setupRoutes() {
-	userHandler := handler.NewUserHandler(s.userService)
+	userHandler := handler.NewUserHandler(s.userService, s.verifier, s.wsHub)
 	roomHandler := handler.NewRoomHandler(s.roomService)
-	wsHandler := handler.NewWebSocketHandler(s.wsHub, s.roomService, s.userRepo)
+	blockHandler := handler.NewBlockHandler(s.blockService, s.wsHub)
+	messageHandler := handler.NewMessageHandler(s.messageService)
+	historyHandler := handler.NewHistoryHandler(s.historyService)
+	accountHandler := handler.NewAccountHandler(s.accountService, s.wsHub)
+	adminHandler := handler.NewAdminHandler(s.adminService, s.wsHub)
+	wsHandler := handler.NewWebSocketHandler(s.wsHub, s.roomService, s.blockService, s.historyService, s.tickets, handler.UpgradeOptions{
+		Origins:              s.origins,
+		ReadBufferSize:       s.config.WSReadBufferSize,
+		WriteBufferSize:      s.config.WSWriteBufferSize,
+		Compression:          s.config.WSCompression,
+		CompressionThreshold: s.config.WSCompressionThreshold,
+	})
+
+	if s.verifier != nil {
+		s.router.POST("/webhook", userHandler.HandleClerkWebhook)
+	}
+
+	apiLimit := rateLimitMiddleware(ratelimit.NewLimiter(s.config.APIRequestRate, s.config.APIRequestBurst))
+
+	// The websocket handshake cannot carry an Authorization header from a
+	// browser, so it authenticates with a ticket from /ws/ticket instead.
+	s.router.GET("/ws", s.trackWebSocket, auth.WebSocketMiddleware(s.authenticator, s.tickets, s.userService), auth.RequireActive(), apiLimit, wsHandler.HandleWebSocket)
 
-	s.router.POST("/webhook", userHandler.HandleClerkWebhook)
+	// Fallbacks for clients that cannot open a websocket. EventSource cannot
+	// set headers either, so these authenticate the same way.
+	streamAuth := auth.WebSocketMiddleware(s.authenticator, s.tickets, s.userService)
+	s.router.GET("/api/v1/rooms/:id/events", streamAuth, auth.RequireActive(), apiLimit, wsHandler.StreamEvents)
+	s.router.GET("/api/v1/rooms/:id/poll", streamAuth, auth.RequireActive(), apiLimit, wsHandler.PollEvents)
 
-	// Apply Clerk middleware to protected routes
 	protected := s.router.Group("/")
-	protected.Use(s.clerkAuthMiddleware())
+	protected.Use(auth.Middleware(s.authenticator, s.userService))
+	protected.Use(auth.RequireActive())
+	protected.Use(apiLimit)
 	{
-		protected.GET("/getRooms", roomHandler.GetRooms)
-		protected.POST("/createRoom", roomHandler.CreateRoom)
-		protected.GET("/ws", wsHandler.HandleWebSocket)
+		createRoomLimit := rateLimitMiddleware(ratelimit.NewLimiter(s.config.CreateRoomRate, s.config.CreateRoomBurst))
+
+		rooms := protected.Group("/api/v1/rooms")
+		{
+			rooms.GET("", roomHandler.GetRooms)
+			rooms.POST("", createRoomLimit, roomHandler.CreateRoom)
+			rooms.GET("/:id", roomHandler.GetRoom)
+			rooms.PATCH("/:id", roomHandler.UpdateRoom)
+			rooms.DELETE("/:id", roomHandler.DeleteRoom)
+			rooms.GET("/:id/members", roomHandler.GetRoomMembers)
+			rooms.POST("/:id/members", roomHandler.AddMember)
+			rooms.DELETE("/:id/members/:user_id", roomHandler.RemoveMember)
+			rooms.GET("/:id/messages", messageHandler.GetRoomMessages)
+			rooms.POST("/:id/messages", wsHandler.PostMessage)
+		}
+
+		// Verb-style routes from before /api/v1. Kept so existing clients
+		// keep working; remove once the frontend has moved over.
+		protected.GET("/getRooms", deprecated("/api/v1/rooms"), roomHandler.GetRooms)
+		protected.POST("/createRoom", deprecated("/api/v1/rooms"), createRoomLimit, roomHandler.CreateRoom)
+		protected.GET("/rooms/:id/messages", deprecated("/api/v1/rooms/:id/messages"), messageHandler.GetRoomMessages)
+
+		protected.DELETE("/me", accountHandler.DeleteAccount)
+		protected.GET("/me/export", accountHandler.ExportData)
+		protected.GET("/users/:id/profile", userHandler.GetProfile)
+		protected.PUT("/users/:id/profile", userHandler.UpdateProfile)
+		protected.GET("/users/:id/history", historyHandler.GetUserHistory)
+		protected.POST("/users/:id/block", blockHandler.BlockUser)
+		protected.DELETE("/users/:id/block", blockHandler.UnblockUser)
+		protected.POST("/ws/ticket", wsHandler.IssueTicket)
 		protected.POST("/ws/joinRoom/:roomId", wsHandler.JoinRoom)
 		protected.POST("/ws/leaveRoom/:roomId", wsHandler.LeaveRoom)
 	}
+
+	admin := protected.Group("/admin")
+	admin.Use(auth.RequireAdmin())
+	{
+		admin.GET("/users", adminHandler.ListUsers)
+		admin.PUT("/users/:id", adminHandler.UpdateUser)
+		admin.GET("/rooms", adminHandler.ListRooms)
+		admin.POST("/rooms/:id/close", adminHandler.CloseRoom)
+		admin.GET("/metrics", gin.WrapH(expvar.Handler()))
+	}
 }
 
-func (s *Server) clerkAuthMiddleware() gin.HandlerFunc {
+// rateLimitMiddleware limits each authenticated user to the limiter's rate.
+// It must run after the auth middleware so the user ID is available.
+func rateLimitMiddleware(limiter *ratelimit.Limiter) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		sessionToken := c.GetHeader("Authorization")
-		if sessionToken == "" {
-			c.JSON(401, gin.H{"error": "No authorization header provided"})
-			c.Abort()
-			return
-		}
-
-		claims, err := s.clerkClient.VerifyToken(sessionToken)
-		if err != nil {
-			c.JSON(401, gin.H{"error": "Invalid session token"})
-			c.Abort()
+		if !limiter.Allow(c.GetString("userID")) {
+			apperr.Abort(c, apperr.RateLimited("Too many requests", limiter.RetryAfter()))
 			return
 		}
+		c.Next()
+	}
+}
 
-		c.Set("userID", claims.Subject)
+// deprecated marks a response as coming from a deprecated route and points
+// clients at the route replacing it.
+func deprecated(successor string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Deprecation", "true")
+		link := strings.ReplaceAll(successor, ":id", c.Param("id"))
+		c.Header("Link", "<"+link+">; rel=\"successor-version\"")
 		c.Next()
 	}
 }
 
-func (s *Server) Run() error {
-	go s.wsHub.Run()
-	return s.router.Run(s.config.ServerAddress)
+func (s *Server) trackWebSocket(c *gin.Context) {
+	s.websockets.Add(1)
+	defer s.websockets.Done()
+	c.Next()
+}
+
+// Run serves until ctx is cancelled, then shuts down within
+// SHUTDOWN_TIMEOUT: it stops accepting requests, waits for those in
+// flight, drains the Hub and closes the database.
+func (s *Server) Run(ctx context.Context) error {
+	hubCtx, stopHub := context.WithCancel(context.Background())
+	defer stopHub()
+	go s.wsHub.Run(hubCtx)
+
+	srv := &http.Server{
+		Addr:    s.config.ServerAddress,
+		Handler: s.router,
+	}
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Printf("shutting down, draining for up to %s", s.config.ShutdownTimeout)
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.ShutdownTimeout)
+	defer cancel()
+
+	// Event streams are ordinary requests that only end once the Hub tells
+	// them it is restarting, so the server and the Hub shut down together.
+	served := make(chan struct{})
+	go func() {
+		defer close(served)
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Printf("failed to finish open requests: %v", err)
+		}
+	}()
+	if err := s.wsHub.Shutdown(ctx); err != nil {
+		log.Printf("failed to drain websocket hub: %v", err)
+	}
+	<-served
+
+	websockets := make(chan struct{})
+	go func() {
+		s.websockets.Wait()
+		close(websockets)
+	}()
+	select {
+	case <-websockets:
+	case <-ctx.Done():
+		log.Printf("websocket handlers still running after %s", s.config.ShutdownTimeout)
+	}
+
+	return s.db.Close()
 }
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kamdyns/movie-chat/internal/apperr"
+	"github.com/kamdyns/movie-chat/internal/model"
+	"github.com/kamdyns/movie-chat/internal/repository"
+)
+
+type AccountService interface {
+	DeleteAccount(ctx context.Context, clerkUserID string) error
+	GetExport(ctx context.Context, clerkUserID string) (*model.UserExport, error)
+	StreamMessages(ctx context.Context, clerkUserID string, fn func(*model.Message) error) error
+}
+
+type accountService struct {
+	accountRepo    repository.AccountRepository
+	deletionPolicy string
+	timeout        time.Duration
+	exportTimeout  time.Duration
+}
+
+func NewAccountService(accountRepo repository.AccountRepository, deletionPolicy string) AccountService {
+	return &accountService{
+		accountRepo:    accountRepo,
+		deletionPolicy: deletionPolicy,
+		timeout:        time.Duration(5) * time.Second,
+		exportTimeout:  time.Duration(5) * time.Minute,
+	}
+}
+
+// DeleteAccount removes a user according to the configured policy. It is
+// safe to call for a user that is already gone.
+func (s *accountService) DeleteAccount(ctx context.Context, clerkUserID string) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	switch s.deletionPolicy {
+	case model.DeletionPolicyPurge:
+		return s.accountRepo.PurgeUser(ctx, clerkUserID)
+	case model.DeletionPolicyAnonymize:
+		return s.accountRepo.AnonymizeUser(ctx, clerkUserID, "deleted_"+uuid.NewString())
+	default:
+		return fmt.Errorf("unknown user deletion policy %q", s.deletionPolicy)
+	}
+}
+
+func (s *accountService) GetExport(ctx context.Context, clerkUserID string) (*model.UserExport, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	export, err := s.accountRepo.GetExport(ctx, clerkUserID)
+	if errors.Is(err, apperr.ErrNotFound) {
+		return nil, ErrUserNotFound
+	}
+	return export, err
+}
+
+func (s *accountService) StreamMessages(ctx context.Context, clerkUserID string, fn func(*model.Message) error) error {
+	ctx, cancel := context.WithTimeout(ctx, s.exportTimeout)
+	defer cancel()
+
+	return s.accountRepo.StreamMessages(ctx, clerkUserID, fn)
+}
@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/kamdyns/movie-chat/internal/apperr"
+	"github.com/kamdyns/movie-chat/internal/model"
+	"github.com/kamdyns/movie-chat/internal/repository"
+)
+
+const maxAdminPageSize = 100
+
+type AdminService interface {
+	ListUsers(ctx context.Context, req *model.AdminUserListReq) (*model.AdminUserListResponse, error)
+	UpdateUser(ctx context.Context, clerkUserID, adminID string, req *model.AdminUpdateUserReq) error
+	ListRooms(ctx context.Context, req *model.AdminRoomListReq) (*model.AdminRoomListResponse, error)
+	CloseRoom(ctx context.Context, roomID string) error
+}
+
+type adminService struct {
+	adminRepo repository.AdminRepository
+	timeout   time.Duration
+}
+
+func NewAdminService(adminRepo repository.AdminRepository) AdminService {
+	return &adminService{
+		adminRepo: adminRepo,
+		timeout:   time.Duration(2) * time.Second,
+	}
+}
+
+func (s *adminService) ListUsers(ctx context.Context, req *model.AdminUserListReq) (*model.AdminUserListResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	normalizePage(&req.Page, &req.Limit)
+
+	users, err := s.adminRepo.ListUsers(ctx, req.Query, req.Limit, (req.Page-1)*req.Limit)
+	if err != nil {
+		return nil, err
+	}
+	total, err := s.adminRepo.CountUsers(ctx, req.Query)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.AdminUserListResponse{
+		Users:       users,
+		TotalCount:  total,
+		CurrentPage: req.Page,
+		TotalPages:  (total + req.Limit - 1) / req.Limit,
+	}, nil
+}
+
+// UpdateUser changes a user's role or suspends them. Admins cannot suspend
+// or demote themselves, so there is always someone left to undo it.
+func (s *adminService) UpdateUser(ctx context.Context, clerkUserID, adminID string, req *model.AdminUpdateUserReq) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	if req.Role != nil && *req.Role != model.RoleUser && *req.Role != model.RoleAdmin {
+		return ErrInvalidInput.Withf("Role must be %q or %q", model.RoleUser, model.RoleAdmin)
+	}
+	if clerkUserID == adminID && ((req.Suspended != nil && *req.Suspended) || (req.Role != nil && *req.Role != model.RoleAdmin)) {
+		return ErrInvalidInput.Withf("Admins cannot suspend or demote themselves")
+	}
+
+	if req.Role != nil {
+		if err := s.adminRepo.SetUserRole(ctx, clerkUserID, *req.Role); err != nil {
+			return userErr(err)
+		}
+	}
+	if req.Suspended != nil {
+		if err := s.adminRepo.SetUserSuspended(ctx, clerkUserID, *req.Suspended); err != nil {
+			return userErr(err)
+		}
+	}
+	return nil
+}
+
+func (s *adminService) ListRooms(ctx context.Context, req *model.AdminRoomListReq) (*model.AdminRoomListResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	switch req.Status {
+	case "", model.RoomStatusActive, model.RoomStatusExpired, model.RoomStatusClosed:
+	default:
+		return nil, ErrInvalidInput.Withf("Unknown room status %q", req.Status)
+	}
+	normalizePage(&req.Page, &req.Limit)
+
+	rooms, err := s.adminRepo.ListRooms(ctx, req.Status, req.Limit, (req.Page-1)*req.Limit)
+	if err != nil {
+		return nil, err
+	}
+	total, err := s.adminRepo.CountRooms(ctx, req.Status)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.AdminRoomListResponse{
+		Rooms:       rooms,
+		TotalCount:  total,
+		CurrentPage: req.Page,
+		TotalPages:  (total + req.Limit - 1) / req.Limit,
+	}, nil
+}
+
+// CloseRoom marks a room closed and expires it. Disconnecting the clients
+// still in it is up to the caller.
+func (s *adminService) CloseRoom(ctx context.Context, roomID string) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	err := s.adminRepo.CloseRoom(ctx, roomID)
+	if errors.Is(err, apperr.ErrNotFound) {
+		return ErrRoomNotFound
+	}
+	return err
+}
+
+func normalizePage(page, limit *int) {
+	if *page < 1 {
+		*page = 1
+	}
+	if *limit <= 0 || *limit > maxAdminPageSize {
+		*limit = maxAdminPageSize
+	}
+}
+
+func userErr(err error) error {
+	if errors.Is(err, apperr.ErrNotFound) {
+		return ErrUserNotFound
+	}
+	return err
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/kamdyns/movie-chat/internal/apperr"
+	"github.com/kamdyns/movie-chat/internal/repository"
+)
+
+type BlockService interface {
+	BlockUser(ctx context.Context, blockerID, blockedID string) error
+	UnblockUser(ctx context.Context, blockerID, blockedID string) error
+	GetBlockedIDs(ctx context.Context, blockerID string) ([]string, error)
+}
+
+type blockService struct {
+	blockRepo repository.BlockRepository
+	userRepo  repository.UserRepository
+	timeout   time.Duration
+}
+
+func NewBlockService(blockRepo repository.BlockRepository, userRepo repository.UserRepository) BlockService {
+	return &blockService{
+		blockRepo: blockRepo,
+		userRepo:  userRepo,
+		timeout:   time.Duration(2) * time.Second,
+	}
+}
+
+func (s *blockService) BlockUser(ctx context.Context, blockerID, blockedID string) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	if blockerID == blockedID {
+		return ErrCannotBlockSelf
+	}
+
+	if _, err := s.userRepo.GetUserByClerkID(ctx, blockedID); err != nil {
+		if errors.Is(err, apperr.ErrNotFound) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+
+	return s.blockRepo.BlockUser(ctx, blockerID, blockedID)
+}
+
+func (s *blockService) UnblockUser(ctx context.Context, blockerID, blockedID string) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	return s.blockRepo.UnblockUser(ctx, blockerID, blockedID)
+}
+
+func (s *blockService) GetBlockedIDs(ctx context.Context, blockerID string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	return s.blockRepo.GetBlockedIDs(ctx, blockerID)
+}
@@ -0,0 +1,13 @@
+package service
+
+import "github.com/kamdyns/movie-chat/internal/apperr"
+
+var (
+	ErrUserNotFound    = apperr.NotFound("user_not_found", "User not found")
+	ErrRoomNotFound    = apperr.NotFound("room_not_found", "Room not found")
+	ErrRoomClosed      = apperr.Gone("room_closed", "Room has been closed")
+	ErrAccountDeleted  = apperr.Gone("account_deleted", "This account has been deleted")
+	ErrCannotBlockSelf = apperr.Validation("cannot_block_self", "Users cannot block themselves")
+	ErrForbidden       = apperr.Forbidden("forbidden", "You are not allowed to do that")
+	ErrInvalidInput    = apperr.Validation("invalid_input", "Invalid input")
+)
@@ -0,0 +1,135 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kamdyns/movie-chat/internal/model"
+	"github.com/kamdyns/movie-chat/internal/repository"
+)
+
+const (
+	maxHistoryRooms        = 50
+	maxHistoryRoomMessages = 100
+)
+
+type HistoryService interface {
+	StartSession(ctx context.Context, roomID, userID string) (uuid.UUID, error)
+	EndSession(ctx context.Context, sessionID uuid.UUID) error
+	GetUserHistory(ctx context.Context, userID, viewerID string, req *model.UserHistoryReq) (*model.UserHistoryResponse, error)
+}
+
+type historyService struct {
+	historyRepo repository.HistoryRepository
+	timeout     time.Duration
+}
+
+func NewHistoryService(historyRepo repository.HistoryRepository) HistoryService {
+	return &historyService{
+		historyRepo: historyRepo,
+		timeout:     time.Duration(2) * time.Second,
+	}
+}
+
+func (s *historyService) StartSession(ctx context.Context, roomID, userID string) (uuid.UUID, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	return s.historyRepo.StartSession(ctx, roomID, userID)
+}
+
+func (s *historyService) EndSession(ctx context.Context, sessionID uuid.UUID) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	return s.historyRepo.EndSession(ctx, sessionID)
+}
+
+// GetUserHistory lists the rooms a user joined between req.From and req.To,
+// most recent first, with their sessions and their own messages in each.
+// History is private, so users can only fetch their own.
+func (s *historyService) GetUserHistory(ctx context.Context, userID, viewerID string, req *model.UserHistoryReq) (*model.UserHistoryResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	if userID != viewerID {
+		return nil, ErrForbidden.Withf("You can only view your own history")
+	}
+
+	if req.Page < 1 {
+		req.Page = 1
+	}
+	if req.Limit <= 0 || req.Limit > maxHistoryRooms {
+		req.Limit = maxHistoryRooms
+	}
+	if req.MessagesLimit < 0 || req.MessagesLimit > maxHistoryRoomMessages {
+		req.MessagesLimit = maxHistoryRoomMessages
+	}
+	if req.To.IsZero() {
+		req.To = time.Now()
+	}
+	if !req.From.Before(req.To) {
+		return nil, ErrInvalidInput.Withf("From must be before to")
+	}
+
+	rooms, err := s.historyRepo.GetRoomActivity(ctx, userID, req.From, req.To, req.Limit, (req.Page-1)*req.Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	totalCount, err := s.historyRepo.CountRoomActivity(ctx, userID, req.From, req.To)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rooms) > 0 {
+		if err := s.attachActivity(ctx, userID, rooms, req); err != nil {
+			return nil, err
+		}
+	}
+
+	return &model.UserHistoryResponse{
+		Rooms:       rooms,
+		TotalCount:  totalCount,
+		CurrentPage: req.Page,
+		TotalPages:  (totalCount + req.Limit - 1) / req.Limit,
+	}, nil
+}
+
+func (s *historyService) attachActivity(ctx context.Context, userID string, rooms []model.RoomHistory, req *model.UserHistoryReq) error {
+	roomIDs := make([]string, len(rooms))
+	byID := make(map[string]*model.RoomHistory, len(rooms))
+	for i := range rooms {
+		rooms[i].Sessions = []model.RoomSession{}
+		rooms[i].Messages = []model.Message{}
+		roomIDs[i] = rooms[i].RoomID
+		byID[rooms[i].RoomID] = &rooms[i]
+	}
+
+	sessions, err := s.historyRepo.GetSessions(ctx, userID, roomIDs, req.From, req.To)
+	if err != nil {
+		return err
+	}
+	for _, session := range sessions {
+		if room, ok := byID[session.RoomID]; ok {
+			room.Sessions = append(room.Sessions, session)
+			room.TotalDurationSeconds += session.DurationSeconds
+		}
+	}
+
+	if req.MessagesLimit == 0 {
+		return nil
+	}
+
+	messages, err := s.historyRepo.GetUserMessages(ctx, userID, roomIDs, req.From, req.To, req.MessagesLimit)
+	if err != nil {
+		return err
+	}
+	for _, msg := range messages {
+		if room, ok := byID[msg.RoomID]; ok {
+			room.Messages = append(room.Messages, msg)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/kamdyns/movie-chat/internal/model"
+	"github.com/kamdyns/movie-chat/internal/repository"
+)
+
+const maxHistoryLimit = 100
+
+type MessageService interface {
+	SaveMessage(ctx context.Context, msg *model.Message) error
+	GetRoomMessages(ctx context.Context, roomID, viewerID string, before time.Time, limit int) ([]model.Message, error)
+	MessagesAfter(ctx context.Context, roomID string, afterSeq int64, limit int) ([]model.Message, error)
+	LastSeq(ctx context.Context, roomID string) (int64, error)
+}
+
+type messageService struct {
+	messageRepo repository.MessageRepository
+	timeout     time.Duration
+}
+
+func NewMessageService(messageRepo repository.MessageRepository) MessageService {
+	return &messageService{
+		messageRepo: messageRepo,
+		timeout:     time.Duration(2) * time.Second,
+	}
+}
+
+func (s *messageService) SaveMessage(ctx context.Context, msg *model.Message) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	_, err := s.messageRepo.CreateMessage(ctx, msg)
+	return err
+}
+
+func (s *messageService) GetRoomMessages(ctx context.Context, roomID, viewerID string, before time.Time, limit int) ([]model.Message, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	if before.IsZero() {
+		before = time.Now()
+	}
+	if limit <= 0 || limit > maxHistoryLimit {
+		limit = maxHistoryLimit
+	}
+
+	return s.messageRepo.GetRoomMessages(ctx, roomID, viewerID, before, limit)
+}
+
+func (s *messageService) MessagesAfter(ctx context.Context, roomID string, afterSeq int64, limit int) ([]model.Message, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	return s.messageRepo.GetMessagesAfter(ctx, roomID, afterSeq, limit)
+}
+
+func (s *messageService) LastSeq(ctx context.Context, roomID string) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	return s.messageRepo.GetLastSeq(ctx, roomID)
+}
@@ -2,40 +2,87 @@ package service
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
+	"github.com/kamdyns/movie-chat/internal/apperr"
 	"github.com/kamdyns/movie-chat/internal/model"
 	"github.com/kamdyns/movie-chat/internal/repository"
+	"github.com/kamdyns/movie-chat/pkg/util"
 )
 
+const (
+	maxRoomNameLength   = 100
+	maxMovieTitleLength = 200
+)
+
+// RoomPolicy bounds how long rooms may live. MaxLifetime counts from when
+// the room was created, so extending a room cannot keep it open forever.
+type RoomPolicy struct {
+	MinLifetime time.Duration
+	MaxLifetime time.Duration
+}
+
 type RoomService interface {
-	CreateRoom(ctx context.Context, room *model.Room) (*model.Room, error)
+	CreateRoom(ctx context.Context, userID string, req *model.CreateRoomReq) (*model.Room, error)
 	GetRooms(ctx context.Context, page, limit int) ([]model.Room, int, error)
 	GetRoom(ctx context.Context, id string) (*model.Room, error)
-	UpdateRoom(ctx context.Context, room *model.Room) (*model.Room, error)
-	DeleteRoom(ctx context.Context, id string) error
-	AddMember(ctx context.Context, roomID string, userID int64) error
-	RemoveMember(ctx context.Context, roomID string, userID int64) error
+	UpdateRoom(ctx context.Context, id, userID string, req *model.UpdateRoomReq) (*model.Room, error)
+	DeleteRoom(ctx context.Context, id, userID string) error
+	AddMember(ctx context.Context, roomID, memberID, userID string) error
+	RemoveMember(ctx context.Context, roomID, memberID, userID string) error
 	GetRoomMembers(ctx context.Context, roomID string) ([]*model.RoomMember, error)
+	IsMember(ctx context.Context, roomID, clerkUserID string) (bool, error)
+	UpdateRoomModes(ctx context.Context, roomID string, modes model.RoomModes) error
 }
 
 type roomService struct {
 	roomRepo repository.RoomRepository
+	policy   RoomPolicy
 	timeout  time.Duration
 }
 
-func NewRoomService(roomRepo repository.RoomRepository) RoomService {
+func NewRoomService(roomRepo repository.RoomRepository, policy RoomPolicy) RoomService {
 	return &roomService{
 		roomRepo: roomRepo,
+		policy:   policy,
 		timeout:  time.Duration(2) * time.Second,
 	}
 }
 
-func (s *roomService) CreateRoom(ctx context.Context, room *model.Room) (*model.Room, error) {
+func (s *roomService) CreateRoom(ctx context.Context, userID string, req *model.CreateRoomReq) (*model.Room, error) {
 	ctx, cancel := context.WithTimeout(ctx, s.timeout)
 	defer cancel()
 
-	return s.roomRepo.CreateRoom(ctx, room)
+	name := strings.TrimSpace(req.Name)
+	movieTitle := strings.TrimSpace(req.MovieTitle)
+
+	var fields []apperr.FieldError
+	fields = appendField(fields, "name", validateRoomName(name))
+	fields = appendField(fields, "movie_title", validateMovieTitle(movieTitle))
+	fields = appendField(fields, "expires_in", s.validateLifetime(req.ExpiresIn, s.policy.MaxLifetime))
+	if len(fields) > 0 {
+		return nil, invalidFields(fields)
+	}
+
+	roomID, err := util.GenerateRoomID()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	return s.roomRepo.CreateRoom(ctx, &model.Room{
+		ID:         roomID,
+		Name:       name,
+		MovieTitle: movieTitle,
+		CreatedBy:  userID,
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(time.Duration(req.ExpiresIn) * time.Second),
+	})
 }
 
 func (s *roomService) GetRooms(ctx context.Context, page, limit int) ([]model.Room, int, error) {
@@ -53,40 +100,104 @@ func (s *roomService) GetRooms(ctx context.Context, page, limit int) ([]model.Ro
 	return rooms, totalCount, nil
 }
 
-// New methods for roomService
 func (s *roomService) GetRoom(ctx context.Context, id string) (*model.Room, error) {
 	ctx, cancel := context.WithTimeout(ctx, s.timeout)
 	defer cancel()
 
-	return s.roomRepo.GetRoom(ctx, id)
+	room, err := s.roomRepo.GetRoom(ctx, id)
+	if errors.Is(err, apperr.ErrNotFound) {
+		return nil, ErrRoomNotFound
+	}
+	return room, err
+}
+
+// ownedRoom returns the room if userID owns it. Only the owner may change a
+// room or its members.
+func (s *roomService) ownedRoom(ctx context.Context, id, userID string) (*model.Room, error) {
+	room, err := s.roomRepo.GetRoom(ctx, id)
+	if err != nil {
+		if errors.Is(err, apperr.ErrNotFound) {
+			return nil, ErrRoomNotFound
+		}
+		return nil, err
+	}
+	if room.CreatedBy != userID {
+		return nil, ErrForbidden.Withf("Only the room owner can do that")
+	}
+	return room, nil
 }
 
-func (s *roomService) UpdateRoom(ctx context.Context, room *model.Room) (*model.Room, error) {
+func (s *roomService) UpdateRoom(ctx context.Context, id, userID string, req *model.UpdateRoomReq) (*model.Room, error) {
 	ctx, cancel := context.WithTimeout(ctx, s.timeout)
 	defer cancel()
 
+	room, err := s.ownedRoom(ctx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if room.ClosedAt != nil {
+		return nil, ErrRoomClosed
+	}
+
+	var fields []apperr.FieldError
+	if req.Name != nil {
+		room.Name = strings.TrimSpace(*req.Name)
+		fields = appendField(fields, "name", validateRoomName(room.Name))
+	}
+	if req.MovieTitle != nil {
+		room.MovieTitle = strings.TrimSpace(*req.MovieTitle)
+		fields = appendField(fields, "movie_title", validateMovieTitle(room.MovieTitle))
+	}
+	if req.ExpiresIn != nil {
+		fields = appendField(fields, "expires_in", s.validateExtension(room, *req.ExpiresIn))
+		room.ExpiresAt = time.Now().Add(time.Duration(*req.ExpiresIn) * time.Second)
+	}
+	if len(fields) > 0 {
+		return nil, invalidFields(fields)
+	}
+
 	return s.roomRepo.UpdateRoom(ctx, room)
 }
 
-func (s *roomService) DeleteRoom(ctx context.Context, id string) error {
+func (s *roomService) DeleteRoom(ctx context.Context, id, userID string) error {
 	ctx, cancel := context.WithTimeout(ctx, s.timeout)
 	defer cancel()
 
+	if _, err := s.ownedRoom(ctx, id, userID); err != nil {
+		return err
+	}
+
 	return s.roomRepo.DeleteRoom(ctx, id)
 }
 
-func (s *roomService) AddMember(ctx context.Context, roomID string, userID int64) error {
+func (s *roomService) AddMember(ctx context.Context, roomID, memberID, userID string) error {
 	ctx, cancel := context.WithTimeout(ctx, s.timeout)
 	defer cancel()
 
-	return s.roomRepo.AddMember(ctx, roomID, userID)
+	if _, err := s.ownedRoom(ctx, roomID, userID); err != nil {
+		return err
+	}
+
+	err := s.roomRepo.AddMember(ctx, roomID, memberID)
+	if errors.Is(err, apperr.ErrNotFound) {
+		return ErrUserNotFound
+	}
+	return err
 }
 
-func (s *roomService) RemoveMember(ctx context.Context, roomID string, userID int64) error {
+// RemoveMember removes a member from a room. Members can remove themselves;
+// removing anyone else takes the owner.
+func (s *roomService) RemoveMember(ctx context.Context, roomID, memberID, userID string) error {
 	ctx, cancel := context.WithTimeout(ctx, s.timeout)
 	defer cancel()
 
-	return s.roomRepo.RemoveMember(ctx, roomID, userID)
+	if memberID != userID {
+		if _, err := s.ownedRoom(ctx, roomID, userID); err != nil {
+			return err
+		}
+	}
+
+	return s.roomRepo.RemoveMember(ctx, roomID, memberID)
 }
 
 func (s *roomService) GetRoomMembers(ctx context.Context, roomID string) ([]*model.RoomMember, error) {
@@ -95,3 +206,85 @@ func (s *roomService) GetRoomMembers(ctx context.Context, roomID string) ([]*mod
 
 	return s.roomRepo.GetRoomMembers(ctx, roomID)
 }
+
+func (s *roomService) IsMember(ctx context.Context, roomID, clerkUserID string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	return s.roomRepo.IsMember(ctx, roomID, clerkUserID)
+}
+
+func (s *roomService) UpdateRoomModes(ctx context.Context, roomID string, modes model.RoomModes) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	return s.roomRepo.UpdateRoomModes(ctx, roomID, modes)
+}
+
+// validateLifetime checks a lifetime in seconds against the policy, with
+// max as the longest lifetime still allowed.
+func (s *roomService) validateLifetime(seconds int64, max time.Duration) string {
+	lifetime := time.Duration(seconds) * time.Second
+	if seconds <= 0 || lifetime < s.policy.MinLifetime {
+		return fmt.Sprintf("Must be at least %d seconds", int64(s.policy.MinLifetime.Seconds()))
+	}
+	if lifetime > max {
+		return fmt.Sprintf("Must be at most %d seconds", int64(max.Seconds()))
+	}
+	return ""
+}
+
+// validateExtension checks a new lifetime for a live room. The room may not
+// outlive MaxLifetime counted from its creation, and expired rooms stay
+// expired.
+func (s *roomService) validateExtension(room *model.Room, seconds int64) string {
+	if !room.ExpiresAt.After(time.Now()) {
+		return "Expired rooms cannot be extended"
+	}
+	return s.validateLifetime(seconds, time.Until(room.CreatedAt.Add(s.policy.MaxLifetime)))
+}
+
+func validateRoomName(name string) string {
+	if name == "" {
+		return "Must not be empty"
+	}
+	if utf8.RuneCountInString(name) > maxRoomNameLength {
+		return fmt.Sprintf("Must be at most %d characters", maxRoomNameLength)
+	}
+	if !printable(name) {
+		return "Must not contain control or invisible characters"
+	}
+	return ""
+}
+
+func validateMovieTitle(title string) string {
+	if utf8.RuneCountInString(title) > maxMovieTitleLength {
+		return fmt.Sprintf("Must be at most %d characters", maxMovieTitleLength)
+	}
+	if !printable(title) {
+		return "Must not contain control or invisible characters"
+	}
+	return ""
+}
+
+// printable rejects control characters and invisible formatting such as
+// zero-width spaces and direction overrides, which are used to spoof names.
+func printable(s string) bool {
+	for _, r := range s {
+		if !unicode.IsPrint(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func appendField(fields []apperr.FieldError, field, message string) []apperr.FieldError {
+	if message == "" {
+		return fields
+	}
+	return append(fields, apperr.FieldError{Field: field, Message: message})
+}
+
+func invalidFields(fields []apperr.FieldError) error {
+	return ErrInvalidInput.Withf("Some fields are invalid").WithFields(fields...)
+}
@@ -2,48 +2,96 @@ package service
 
 import (
 	"context"
+	"errors"
+	"net/url"
 	"time"
+	"unicode/utf8"
 
+	"github.com/kamdyns/movie-chat/internal/apperr"
 	"github.com/kamdyns/movie-chat/internal/model"
 	"github.com/kamdyns/movie-chat/internal/repository"
 )
 
+const (
+	maxDisplayNameLength = 50
+	maxBioLength         = 500
+	maxFavoriteGenres    = 10
+	maxGenreLength       = 30
+	maxUsernameLength    = 50
+)
+
 type UserService interface {
-	HandleClerkWebhook(ctx context.Context, event *model.ClerkWebhookEvent) error
+	HandleClerkWebhook(ctx context.Context, eventID string, event *model.ClerkWebhookEvent) error
+	EnsureUser(ctx context.Context, clerkUserID string) (*model.User, error)
+	GetProfile(ctx context.Context, clerkUserID, viewerID string) (*model.UserProfile, error)
+	UpdateProfile(ctx context.Context, clerkUserID, viewerID string, req *model.UpdateProfileReq) (*model.UserProfile, error)
 }
 
 type userService struct {
-	userRepo repository.UserRepository
-	timeout  time.Duration
+	userRepo       repository.UserRepository
+	sessionRepo    repository.SessionRepository
+	webhookRepo    repository.WebhookRepository
+	accountService AccountService
+	timeout        time.Duration
 }
 
-func NewUserService(userRepo repository.UserRepository) UserService {
+func NewUserService(userRepo repository.UserRepository, sessionRepo repository.SessionRepository, webhookRepo repository.WebhookRepository, accountService AccountService) UserService {
 	return &userService{
-		userRepo: userRepo,
-		timeout:  time.Duration(2) * time.Second,
+		userRepo:       userRepo,
+		sessionRepo:    sessionRepo,
+		webhookRepo:    webhookRepo,
+		accountService: accountService,
+		timeout:        time.Duration(2) * time.Second,
 	}
 }
 
-func (s *userService) HandleClerkWebhook(ctx context.Context, event *model.ClerkWebhookEvent) error {
+// HandleClerkWebhook applies a verified Clerk event. Clerk redelivers events
+// until they succeed, so each event ID is only applied once and every case
+// is safe to repeat should two deliveries race.
+func (s *userService) HandleClerkWebhook(ctx context.Context, eventID string, event *model.ClerkWebhookEvent) error {
 	ctx, cancel := context.WithTimeout(ctx, s.timeout)
 	defer cancel()
 
+	processed, err := s.webhookRepo.IsProcessed(ctx, eventID)
+	if err != nil {
+		return err
+	}
+	if processed {
+		return nil
+	}
+
+	if err := s.applyClerkEvent(ctx, event); err != nil {
+		return err
+	}
+
+	return s.webhookRepo.MarkProcessed(ctx, eventID, event.Type)
+}
+
+func (s *userService) applyClerkEvent(ctx context.Context, event *model.ClerkWebhookEvent) error {
 	switch event.Type {
-	case "user.created":
+	case model.ClerkEventUserCreated, model.ClerkEventUserUpdated:
+		// Both upsert, so an update that overtakes its create, or a changed
+		// primary email, still leaves the row current.
 		user := &model.User{
 			ClerkUserID: event.Data.ID,
 			Username:    event.Data.Username,
-			Email:       event.Data.Email,
+			Email:       event.PrimaryEmail(),
 		}
 		_, err := s.userRepo.CreateUser(ctx, user)
-		return err
-	case "user.updated":
-		user := &model.User{
-			ClerkUserID: event.Data.ID,
-			Username:    event.Data.Username,
-			Email:       event.Data.Email,
+		if errors.Is(err, apperr.ErrNotFound) {
+			return nil // The account was deleted here; keep it that way.
 		}
-		return s.userRepo.UpdateUser(ctx, user)
+		return err
+	case model.ClerkEventUserDeleted:
+		return s.accountService.DeleteAccount(ctx, event.Data.ID)
+	case model.ClerkEventSessionCreated:
+		return s.sessionRepo.UpsertSession(ctx, &model.Session{
+			ID:     event.Data.ID,
+			UserID: event.Data.UserID,
+			Status: event.Data.Status,
+		})
+	case model.ClerkEventSessionEnded, model.ClerkEventSessionRemoved, model.ClerkEventSessionRevoked:
+		return s.sessionRepo.EndSession(ctx, event.Data.ID, event.Data.Status)
 	default:
 		return nil // Ignore unhandled event types
 	}
@@ -55,3 +103,116 @@ func (s *userService) GetUserDetails(ctx context.Context, clerkUserID string) (*
 
 	return s.userRepo.GetUserByClerkID(ctx, clerkUserID)
 }
+
+// EnsureUser returns the local user for a verified token. A user can sign in
+// before Clerk's user.created webhook reaches us, so unknown users get a
+// placeholder row, named after their ID, that the webhook fills in later.
+// Users who deleted their account are not provisioned again, even though
+// their Clerk account, and so their token, may still be valid.
+func (s *userService) EnsureUser(ctx context.Context, clerkUserID string) (*model.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	user, err := s.userRepo.GetUserByClerkID(ctx, clerkUserID)
+	if err == nil {
+		return user, nil
+	}
+	if !errors.Is(err, apperr.ErrNotFound) {
+		return nil, err
+	}
+
+	username := clerkUserID
+	if len(username) > maxUsernameLength {
+		username = username[:maxUsernameLength]
+	}
+	user, err = s.userRepo.ProvisionUser(ctx, &model.User{ClerkUserID: clerkUserID, Username: username})
+	if errors.Is(err, apperr.ErrNotFound) {
+		return nil, ErrAccountDeleted
+	}
+	return user, err
+}
+
+// GetProfile returns a user's public profile. Notification preferences are
+// private and only included when users view their own profile.
+func (s *userService) GetProfile(ctx context.Context, clerkUserID, viewerID string) (*model.UserProfile, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	profile, err := s.userRepo.GetProfile(ctx, clerkUserID)
+	if err != nil {
+		if errors.Is(err, apperr.ErrNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	if clerkUserID != viewerID {
+		profile.NotificationPreferences = nil
+	}
+	return profile, nil
+}
+
+func (s *userService) UpdateProfile(ctx context.Context, clerkUserID, viewerID string, req *model.UpdateProfileReq) (*model.UserProfile, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	if clerkUserID != viewerID {
+		return nil, ErrForbidden.Withf("You can only update your own profile")
+	}
+	if err := validateProfileReq(req); err != nil {
+		return nil, err
+	}
+
+	profile, err := s.userRepo.GetProfile(ctx, clerkUserID)
+	if err != nil {
+		if errors.Is(err, apperr.ErrNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	if req.DisplayName != nil {
+		profile.DisplayName = *req.DisplayName
+	}
+	if req.AvatarURL != nil {
+		profile.AvatarURL = *req.AvatarURL
+	}
+	if req.Bio != nil {
+		profile.Bio = *req.Bio
+	}
+	if req.FavoriteGenres != nil {
+		profile.FavoriteGenres = req.FavoriteGenres
+	}
+	if req.NotificationPreferences != nil {
+		profile.NotificationPreferences = req.NotificationPreferences
+	}
+
+	if err := s.userRepo.UpdateProfile(ctx, profile); err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
+
+func validateProfileReq(req *model.UpdateProfileReq) error {
+	if req.DisplayName != nil && utf8.RuneCountInString(*req.DisplayName) > maxDisplayNameLength {
+		return ErrInvalidInput.Withf("Display name must be at most %d characters", maxDisplayNameLength)
+	}
+	if req.Bio != nil && utf8.RuneCountInString(*req.Bio) > maxBioLength {
+		return ErrInvalidInput.Withf("Bio must be at most %d characters", maxBioLength)
+	}
+	if req.AvatarURL != nil && *req.AvatarURL != "" {
+		u, err := url.Parse(*req.AvatarURL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return ErrInvalidInput.Withf("Avatar URL must be an http or https URL")
+		}
+	}
+	if len(req.FavoriteGenres) > maxFavoriteGenres {
+		return ErrInvalidInput.Withf("At most %d favorite genres are allowed", maxFavoriteGenres)
+	}
+	for _, genre := range req.FavoriteGenres {
+		if genre == "" || utf8.RuneCountInString(genre) > maxGenreLength {
+			return ErrInvalidInput.Withf("Genres must be between 1 and %d characters", maxGenreLength)
+		}
+	}
+	return nil
+}
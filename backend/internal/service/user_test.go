@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/kamdyns/movie-chat/internal/apperr"
+	"github.com/kamdyns/movie-chat/internal/model"
+	"github.com/kamdyns/movie-chat/internal/repository"
+)
+
+type memWebhookRepo struct {
+	processed map[string]string
+}
+
+func (r *memWebhookRepo) IsProcessed(ctx context.Context, eventID string) (bool, error) {
+	_, ok := r.processed[eventID]
+	return ok, nil
+}
+
+func (r *memWebhookRepo) MarkProcessed(ctx context.Context, eventID, eventType string) error {
+	r.processed[eventID] = eventType
+	return nil
+}
+
+type countingUserRepo struct {
+	repository.UserRepository
+	created []string
+}
+
+func (r *countingUserRepo) CreateUser(ctx context.Context, user *model.User) (*model.User, error) {
+	r.created = append(r.created, user.ClerkUserID)
+	return user, nil
+}
+
+type countingAccountService struct {
+	AccountService
+	deleted []string
+}
+
+func (s *countingAccountService) DeleteAccount(ctx context.Context, clerkUserID string) error {
+	s.deleted = append(s.deleted, clerkUserID)
+	return nil
+}
+
+func TestHandleClerkWebhookAppliesEachEventOnce(t *testing.T) {
+	users := &countingUserRepo{}
+	accounts := &countingAccountService{}
+	webhooks := &memWebhookRepo{processed: make(map[string]string)}
+	s := NewUserService(users, nil, webhooks, accounts)
+
+	created := &model.ClerkWebhookEvent{Type: model.ClerkEventUserCreated}
+	created.Data.ID = "user_1"
+	deleted := &model.ClerkWebhookEvent{Type: model.ClerkEventUserDeleted}
+	deleted.Data.ID = "user_1"
+
+	ctx := context.Background()
+	for _, delivery := range []struct {
+		id    string
+		event *model.ClerkWebhookEvent
+	}{
+		{"msg_1", created},
+		{"msg_1", created},
+		{"msg_2", deleted},
+		{"msg_2", deleted},
+	} {
+		if err := s.HandleClerkWebhook(ctx, delivery.id, delivery.event); err != nil {
+			t.Fatalf("HandleClerkWebhook(%s) = %v", delivery.id, err)
+		}
+	}
+
+	if len(users.created) != 1 {
+		t.Errorf("user.created applied %d times, want 1", len(users.created))
+	}
+	if len(accounts.deleted) != 1 {
+		t.Errorf("user.deleted applied %d times, want 1", len(accounts.deleted))
+	}
+	if webhooks.processed["msg_2"] != model.ClerkEventUserDeleted {
+		t.Errorf("msg_2 recorded as %q", webhooks.processed["msg_2"])
+	}
+}
+
+type deletedUserRepo struct {
+	repository.UserRepository
+}
+
+func (deletedUserRepo) GetUserByClerkID(ctx context.Context, clerkUserID string) (*model.User, error) {
+	return nil, apperr.NotFound("not_found", "Not found")
+}
+
+func (deletedUserRepo) ProvisionUser(ctx context.Context, user *model.User) (*model.User, error) {
+	return nil, apperr.NotFound("not_found", "Not found")
+}
+
+func TestEnsureUserRefusesDeletedAccounts(t *testing.T) {
+	s := NewUserService(deletedUserRepo{}, nil, nil, nil)
+
+	_, err := s.EnsureUser(context.Background(), "user_1")
+	if !errors.Is(err, ErrAccountDeleted) {
+		t.Fatalf("EnsureUser() = %v, want %v", err, ErrAccountDeleted)
+	}
+}
@@ -0,0 +1,113 @@
+package webhook
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+var (
+	testSecret  = "whsec_" + base64.StdEncoding.EncodeToString([]byte("test-signing-secret"))
+	otherSecret = "whsec_" + base64.StdEncoding.EncodeToString([]byte("rotated-secret"))
+)
+
+func newTestVerifier(t *testing.T, now time.Time) *Verifier {
+	t.Helper()
+	v, err := NewVerifier(testSecret, 5*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.now = func() time.Time { return now }
+	return v
+}
+
+func signed(t *testing.T, secret string, at time.Time, body []byte) http.Header {
+	t.Helper()
+	header, err := Sign(secret, "msg_123", at, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return header
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	body := []byte(`{"type":"user.created","data":{"id":"user_1"}}`)
+
+	tests := []struct {
+		name   string
+		header func() http.Header
+		body   []byte
+		want   error
+	}{
+		{
+			name:   "valid",
+			header: func() http.Header { return signed(t, testSecret, now, body) },
+			body:   body,
+		},
+		{
+			name:   "tampered body",
+			header: func() http.Header { return signed(t, testSecret, now, body) },
+			body:   []byte(`{"type":"user.deleted","data":{"id":"user_1"}}`),
+			want:   ErrInvalidSignature,
+		},
+		{
+			name:   "stale timestamp",
+			header: func() http.Header { return signed(t, testSecret, now.Add(-6*time.Minute), body) },
+			body:   body,
+			want:   ErrInvalidTimestamp,
+		},
+		{
+			name:   "future timestamp",
+			header: func() http.Header { return signed(t, testSecret, now.Add(6*time.Minute), body) },
+			body:   body,
+			want:   ErrInvalidTimestamp,
+		},
+		{
+			name:   "wrong secret",
+			header: func() http.Header { return signed(t, otherSecret, now, body) },
+			body:   body,
+			want:   ErrInvalidSignature,
+		},
+		{
+			name: "one of several signatures",
+			header: func() http.Header {
+				header := signed(t, testSecret, now, body)
+				old := signed(t, otherSecret, now, body).Get(HeaderSignature)
+				header.Set(HeaderSignature, "v2,unknown "+old+" "+header.Get(HeaderSignature))
+				return header
+			},
+			body: body,
+		},
+		{
+			name: "missing headers",
+			header: func() http.Header {
+				header := signed(t, testSecret, now, body)
+				header.Del(HeaderID)
+				return header
+			},
+			body: body,
+			want: ErrMissingHeaders,
+		},
+	}
+
+	v := newTestVerifier(t, now)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := v.Verify(tt.header(), tt.body)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Verify() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewVerifierRejectsBadSecrets(t *testing.T) {
+	for _, secret := range []string{"", "whsec_", "whsec_not base64!"} {
+		if _, err := NewVerifier(secret, time.Minute); err == nil {
+			t.Errorf("NewVerifier(%q) succeeded", secret)
+		}
+	}
+}
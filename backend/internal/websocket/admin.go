@@ -0,0 +1,53 @@
+package websocket
+
+type roomClose struct {
+	RoomID string `json:"room_id"`
+	Reason string `json:"reason"`
+}
+
+// ConnectionCounts returns how many clients are connected to each live room
+// on this instance. Idle rooms are left out.
+func (h *Hub) ConnectionCounts() map[string]int {
+	counts := make(map[string]int)
+	for _, s := range h.shards {
+		s.do(func() {
+			for id, r := range s.rooms {
+				if len(r.Clients) > 0 {
+					counts[id] = len(r.Clients)
+				}
+			}
+		})
+	}
+	return counts
+}
+
+// CloseRoom unsubscribes everyone from a room and forgets it, so a room
+// closed by an admin does not linger until its last client leaves.
+// Connections that were only in that room are closed.
+func (h *Hub) CloseRoom(roomID, reason string) {
+	h.publish(roomChannel(roomID), &event{Kind: eventClose, Close: &roomClose{RoomID: roomID, Reason: reason}})
+}
+
+// DisconnectUser drops every connection userID has open, in any room.
+func (h *Hub) DisconnectUser(userID, reason string) {
+	h.publish(hubChannel, &event{Kind: eventDisconnect, Disconnect: &disconnect{UserID: userID, Code: CloseSuspended, Reason: reason}})
+}
+
+// AccountDeleted drops every connection of a user whose account is gone.
+func (h *Hub) AccountDeleted(userID string) {
+	h.publish(hubChannel, &event{Kind: eventDisconnect, Disconnect: &disconnect{UserID: userID, Code: CloseAccountDeleted, Reason: "Account deleted"}})
+}
+
+func (s *shard) closeRoom(rc *roomClose) {
+	r, ok := s.rooms[rc.RoomID]
+	if !ok {
+		return
+	}
+
+	// The room is gone before its clients are unsubscribed, so nobody is
+	// told they left.
+	for cl := range r.Clients {
+		go cl.roomClosed(rc.Reason)
+	}
+	s.dropRoom(rc.RoomID)
+}
@@ -0,0 +1,265 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/kamdyns/movie-chat/internal/backplane"
+)
+
+// hubChannel carries events that are not tied to one room, such as
+// disconnecting a user wherever they are connected.
+const hubChannel = "hub"
+
+func roomChannel(roomID string) string {
+	return "room:" + roomID
+}
+
+const (
+	eventMessage    = "message"
+	eventClose      = "close"
+	eventDisconnect = "disconnect"
+	eventBlock      = "block"
+	// eventResult carries the outcome of work a shard handed to another
+	// goroutine back to the shard. It never comes from the backplane.
+	eventResult = "result"
+)
+
+// event is what a Hub publishes on the backplane. Every Hub, including the
+// one that published it, acts on an event only when it comes back from the
+// backplane, so all of them apply events in the same order.
+type event struct {
+	Kind       string       `json:"kind"`
+	Message    *Message     `json:"message,omitempty"`
+	Close      *roomClose   `json:"close,omitempty"`
+	Disconnect *disconnect  `json:"disconnect,omitempty"`
+	Block      *blockChange `json:"block,omitempty"`
+
+	// result is run on the shard for eventResult.
+	result func()
+}
+
+// outbound is an event waiting to be published. If sequence is set the
+// event is numbered in that sequence, and published is called with the
+// number once it is out.
+type outbound struct {
+	channel   string
+	payload   []byte
+	sequence  string
+	published func(seq int64, err error)
+}
+
+func encodeEvent(channel string, ev *event) (*outbound, bool) {
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		log.Printf("failed to encode %s event: %v", ev.Kind, err)
+		return nil, false
+	}
+	return &outbound{channel: channel, payload: payload}, true
+}
+
+// publish queues ev for the backplane, waiting while the queue is full
+// unless the Hub stops. It must not be called from a shard; shards use
+// shard.publish.
+func (h *Hub) publish(channel string, ev *event) {
+	o, ok := encodeEvent(channel, ev)
+	if !ok {
+		return
+	}
+
+	h.pending.Add(1)
+	select {
+	case h.outbound <- o:
+	case <-h.done:
+		h.pending.Add(-1)
+	}
+}
+
+// publish queues ev for the backplane. While the queue is full the shard
+// keeps applying events from the backplane, which is what eventually drains
+// the queue, so a busy backplane slows senders down instead of losing
+// messages or deadlocking.
+func (s *shard) publish(channel string, ev *event) {
+	if o, ok := encodeEvent(channel, ev); ok {
+		s.queue(o)
+	}
+}
+
+// queue also runs tasks, such as Shutdown's drain, and gives up once the
+// Hub stops, so a shard stuck behind a full queue does not keep Shutdown
+// waiting. The sender of a chat message given up on
+// is told it failed.
+func (s *shard) queue(o *outbound) {
+	s.hub.pending.Add(1)
+	for {
+		select {
+		case s.hub.outbound <- o:
+			return
+		case ev := <-s.events:
+			s.apply(ev)
+		case task := <-s.tasks:
+			task()
+		case <-s.hub.done:
+			s.hub.pending.Add(-1)
+			if o.published != nil {
+				o.published(0, errHubStopped)
+			}
+			return
+		}
+	}
+}
+
+// publishEvents sends queued events one at a time, so a Hub's own events
+// reach the backplane in the order it produced them.
+func (h *Hub) publishEvents() {
+	for o := range h.outbound {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		var seq int64
+		var err error
+		if o.sequence != "" {
+			seq, err = h.Backplane.PublishSequenced(ctx, o.channel, o.sequence, o.payload)
+		} else {
+			err = h.Backplane.Publish(ctx, o.channel, o.payload)
+		}
+		if err != nil {
+			log.Printf("failed to publish on %s: %v", o.channel, err)
+		}
+		if o.published != nil {
+			o.published(seq, err)
+		}
+		cancel()
+		h.pending.Add(-1)
+	}
+}
+
+func (h *Hub) subscribe(channel string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	err := h.Backplane.Subscribe(ctx, channel)
+	if err != nil {
+		log.Printf("failed to subscribe to %s: %v", channel, err)
+	}
+	return err
+}
+
+func (h *Hub) unsubscribe(channel string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	err := h.Backplane.Unsubscribe(ctx, channel)
+	if err != nil {
+		log.Printf("failed to unsubscribe from %s: %v", channel, err)
+	}
+	return err
+}
+
+// subscription is a change to the room channels the Hub listens on. done
+// is called on the shard that asked for it once the change has been made.
+type subscription struct {
+	channel     string
+	unsubscribe bool
+	done        func(err error)
+}
+
+// receive hands an event from the backplane to the shard that owns its
+// room, or to every shard for events that are not about one room. It gives
+// up if ctx is cancelled or the Hub is stopped while a shard is busy.
+func (h *Hub) receive(ctx context.Context, bm backplane.Message) {
+	ev := new(event)
+	if err := json.Unmarshal(bm.Payload, ev); err != nil {
+		log.Printf("failed to decode event on %s: %v", bm.Channel, err)
+		return
+	}
+
+	switch {
+	case ev.Kind == eventMessage && ev.Message != nil:
+		ev.Message.Seq = bm.Seq
+		h.forward(ctx, h.shardFor(ev.Message.RoomID), ev)
+	case ev.Kind == eventClose && ev.Close != nil:
+		h.forward(ctx, h.shardFor(ev.Close.RoomID), ev)
+	case ev.Kind == eventDisconnect && ev.Disconnect != nil, ev.Kind == eventBlock && ev.Block != nil:
+		for _, s := range h.shards {
+			if !h.forward(ctx, s, ev) {
+				return
+			}
+		}
+	}
+}
+
+func (h *Hub) forward(ctx context.Context, s *shard, ev *event) bool {
+	select {
+	case s.events <- ev:
+		return true
+	case <-ctx.Done():
+	case <-h.quit:
+	}
+	return false
+}
+
+// post runs f on the shard's goroutine without waiting for it, unless the
+// Hub has stopped. It is how goroutines the shard started hand back their
+// results.
+func (s *shard) post(f func()) {
+	select {
+	case s.events <- &event{Kind: eventResult, result: f}:
+	case <-s.hub.done:
+	}
+}
+
+// changeSubscription makes sub in its own goroutine, so a backplane that is
+// slow to subscribe only holds up the room waiting for it. Changes to the
+// same channel are made one at a time, in order, so a room that is dropped
+// and joined again ends up subscribed.
+func (s *shard) changeSubscription(sub *subscription) {
+	queued, busy := s.subscriptions[sub.channel]
+	s.subscriptions[sub.channel] = append(queued, sub)
+	if !busy {
+		s.startSubscription(sub)
+	}
+}
+
+func (s *shard) startSubscription(sub *subscription) {
+	go func() {
+		var err error
+		if sub.unsubscribe {
+			err = s.hub.unsubscribe(sub.channel)
+		} else {
+			err = s.hub.subscribe(sub.channel)
+		}
+		s.post(func() { s.subscriptionChanged(sub, err) })
+	}()
+}
+
+// subscriptionChanged finishes sub and starts the next change waiting for
+// its channel.
+func (s *shard) subscriptionChanged(sub *subscription, err error) {
+	queued := s.subscriptions[sub.channel][1:]
+	if len(queued) == 0 {
+		delete(s.subscriptions, sub.channel)
+	} else {
+		s.subscriptions[sub.channel] = queued
+		s.startSubscription(queued[0])
+	}
+
+	if sub.done != nil {
+		sub.done(err)
+	}
+}
+
+// publishPresence tells the room that cl joined or left.
+func (s *shard) publishPresence(cl *Client, kind string) {
+	verb := "joined"
+	if kind == MessageTypeLeave {
+		verb = "left"
+	}
+	s.publish(roomChannel(cl.RoomID), &event{Kind: eventMessage, Message: &Message{
+		Type:     kind,
+		Content:  cl.Username + " has " + verb + " the room",
+		RoomID:   cl.RoomID,
+		UserID:   cl.ID,
+		Username: cl.Username,
+	}})
+}
@@ -0,0 +1,161 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kamdyns/movie-chat/internal/backplane"
+)
+
+// slowBackplane holds up subscribing to one channel until release is
+// closed, like a Postgres listener that is reconnecting.
+type slowBackplane struct {
+	*backplane.Local
+	channel string
+	release chan struct{}
+}
+
+func (b *slowBackplane) Subscribe(ctx context.Context, channel string) error {
+	if channel == b.channel {
+		<-b.release
+	}
+	return b.Local.Subscribe(ctx, channel)
+}
+
+func nextMessage(t *testing.T, ch <-chan *Message) *Message {
+	t.Helper()
+	select {
+	case m := <-ch:
+		return m
+	case <-time.After(2 * time.Second):
+		t.Fatal("no message received")
+	}
+	return nil
+}
+
+func TestSlowSubscribeDoesNotStallTheShard(t *testing.T) {
+	bp := &slowBackplane{Local: backplane.NewLocal(nil), channel: roomChannel("slow"), release: make(chan struct{})}
+	hub := NewHub(Options{Backplane: bp, Shards: 1})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Run(ctx)
+
+	waiting := &Client{ID: "user_1", Username: "one", RoomID: "slow", Message: make(chan *Message, 8)}
+	hub.Register(waiting)
+
+	other := &Client{ID: "user_2", Username: "two", RoomID: "fast", Message: make(chan *Message, 8)}
+	hub.Register(other)
+	if m := nextMessage(t, other.Message); m.Type != MessageTypeJoin || m.RoomID != "fast" {
+		t.Fatalf("got %+v, want the join in fast", m)
+	}
+
+	select {
+	case m := <-waiting.Message:
+		t.Fatalf("got %+v before the room was subscribed", m)
+	default:
+	}
+	close(bp.release)
+	if m := nextMessage(t, waiting.Message); m.Type != MessageTypeJoin || m.RoomID != "slow" {
+		t.Fatalf("got %+v, want the join in slow", m)
+	}
+}
+
+func TestLeavingBeforeSubscribedIsSilent(t *testing.T) {
+	bp := &slowBackplane{Local: backplane.NewLocal(nil), channel: roomChannel("slow"), release: make(chan struct{})}
+	hub := NewHub(Options{Backplane: bp, Shards: 1})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Run(ctx)
+
+	early := &Client{ID: "user_1", Username: "one", RoomID: "slow", Message: make(chan *Message, 8)}
+	hub.Register(early)
+	waitForClients(t, hub, "slow", 1)
+	hub.Unregister(early)
+	waitForClients(t, hub, "slow", 0)
+	late := &Client{ID: "user_2", Username: "two", RoomID: "slow", Message: make(chan *Message, 8)}
+	hub.Register(late)
+	close(bp.release)
+
+	// The room was dropped and joined again, so it must still end up
+	// subscribed, and late only hears about itself.
+	if m := nextMessage(t, late.Message); m.Type != MessageTypeJoin || m.UserID != "user_2" {
+		t.Fatalf("got %+v, want user_2's join", m)
+	}
+	select {
+	case m := <-late.Message:
+		t.Fatalf("unexpected %+v", m)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestMessagesWaitForTheSubscription(t *testing.T) {
+	bp := &slowBackplane{Local: backplane.NewLocal(nil), channel: roomChannel("slow"), release: make(chan struct{})}
+	hub := NewHub(Options{Backplane: bp, Shards: 1})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Run(ctx)
+
+	cl := &Client{ID: "user_1", RoomID: "slow", Silent: true, Message: make(chan *Message, 8)}
+	hub.Register(cl)
+	waitForClients(t, hub, "slow", 1)
+	hub.Broadcast(&Message{Type: MessageTypeChat, RoomID: "slow", UserID: "user_2", Content: "early"})
+	// Broadcast returns before the shard has the message.
+	time.Sleep(20 * time.Millisecond)
+	close(bp.release)
+
+	if m := nextMessage(t, cl.Message); m.Content != "early" || m.Seq != 1 {
+		t.Fatalf("got %+v, want the early message", m)
+	}
+}
+
+// stuckBackplane never manages to publish.
+type stuckBackplane struct {
+	*backplane.Local
+}
+
+func (b stuckBackplane) Publish(ctx context.Context, channel string, payload []byte) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (b stuckBackplane) PublishSequenced(ctx context.Context, channel, key string, payload []byte) (int64, error) {
+	<-ctx.Done()
+	return 0, ctx.Err()
+}
+
+func TestShutdownWithAFullQueue(t *testing.T) {
+	hub := NewHub(Options{Backplane: stuckBackplane{backplane.NewLocal(nil)}, Shards: 1})
+	go hub.Run(context.Background())
+
+	hub.Register(&Client{ID: "user_1", RoomID: "r", Silent: true, Message: make(chan *Message, 8)})
+	waitForClients(t, hub, "r", 1)
+	go func() {
+		for i := 0; i < 2*cap(hub.outbound); i++ {
+			hub.Broadcast(&Message{Type: MessageTypeChat, RoomID: "r", UserID: "user_1", Content: "stuck"})
+		}
+	}()
+	for len(hub.outbound) < cap(hub.outbound) {
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	errc := make(chan error, 1)
+	go func() { errc <- hub.Shutdown(ctx) }()
+
+	select {
+	case err := <-errc:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("Shutdown() = %v, want the unpublished messages reported", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Shutdown() did not return")
+	}
+	select {
+	case <-hub.stopped:
+	default:
+		t.Fatal("the Hub did not stop")
+	}
+}
@@ -1,62 +1,202 @@
 package websocket
 
 import (
-	"log"
+	"encoding/json"
 
-	"github.com/gorilla/websocket"
+	"github.com/kamdyns/movie-chat/internal/model"
 )
 
+// Client is a connection's subscription to one room. It is what the Hub
+// registers in the room and delivers the room's messages to.
 type Client struct {
-	Conn     *websocket.Conn
 	Message  chan *Message
 	ID       string `json:"id"` // This should be the Clerk User ID
 	RoomID   string `json:"room_id"`
 	Username string `json:"username"`
+
+	// RoomInfo is the room as stored when the client subscribed. The Hub
+	// takes the room's name and modes from it if the room is not live yet.
+	RoomInfo    *model.Room `json:"-"`
+	IsModerator bool        `json:"-"`
+	IsMember    bool        `json:"-"`
+	// Blocked holds the IDs of users whose messages are not delivered to
+	// this client. Only the Hub touches it once the client is registered,
+	// so every subscription of a connection needs its own.
+	Blocked map[string]bool `json:"-"`
+
+	// SessionID is the session of the connection the client belongs to.
+	SessionID string `json:"-"`
+	// LastSeq is the last sequence number the client saw in the room
+	// before reconnecting. Messages after it are replayed when it joins.
+	LastSeq int64 `json:"-"`
+	// Silent clients join and leave without the room being told, for
+	// transports such as long polling that reconnect for every batch.
+	Silent bool `json:"-"`
+
+	// conn is the connection the client belongs to. It is nil for clients
+	// registered without one, such as in benchmarks.
+	conn *Connection
+	// dropped counts messages missed in a row because Message was full,
+	// and closing marks a client being disconnected for it. Only the
+	// client's shard touches them.
+	dropped int
+	closing bool
+	// resumedThrough is the last sequence number sent to the client while
+	// resuming, so the same messages arriving live are not sent twice.
+	// Only the client's shard touches it.
+	resumedThrough int64
+	// resuming is set while the messages the client missed are read from
+	// the store, and held keeps the live messages that arrive meanwhile, up
+	// to the size of its buffer. overflowed records that more arrived.
+	// Only the client's shard touches them.
+	resuming   bool
+	held       []*Message
+	overflowed bool
 }
 
+const (
+	MessageTypeChat  = "chat"
+	MessageTypeJoin  = "join"
+	MessageTypeLeave = "leave"
+	MessageTypeError = "error"
+	MessageTypeMode  = "mode"
+	MessageTypeAuth  = "authenticate"
+	// MessageTypeAck confirms a client's chat message was accepted, and
+	// MessageTypeResync tells a resuming client it missed too much to be
+	// replayed.
+	MessageTypeAck    = "ack"
+	MessageTypeResync = "resync"
+	// MessageTypeRestart tells clients the server is going away and they
+	// should reconnect after RetryAfter milliseconds.
+	MessageTypeRestart = "restart"
+	// Connections join and leave rooms with subscribe and unsubscribe, and
+	// are told with unsubscribed once they have left one.
+	MessageTypeSubscribe    = "subscribe"
+	MessageTypeUnsubscribe  = "unsubscribe"
+	MessageTypeUnsubscribed = "unsubscribed"
+)
+
+const (
+	ErrorCodeRejected      = "message_rejected"
+	ErrorCodeRateLimited   = "rate_limited"
+	ErrorCodeRoomBusy      = "room_busy"
+	ErrorCodeSlowMode      = "slow_mode"
+	ErrorCodeMembersOnly   = "members_only"
+	ErrorCodeEmojiOnly     = "emoji_only"
+	ErrorCodeForbidden     = "forbidden"
+	ErrorCodeUnauthorized  = "unauthorized"
+	ErrorCodeInvalid       = "invalid_request"
+	ErrorCodeInternal      = "internal_error"
+	ErrorCodeNotSubscribed = "not_subscribed"
+	ErrorCodeRoomClosed    = "room_closed"
+)
+
+// Message is what clients receive. Seq numbers a room's chat messages in
+// the order every client sees them. ClientID echoes the ID a client gave
+// the chat message it sent, so it can match acks and errors to it.
 type Message struct {
-	Content  string `json:"content"`
-	RoomID   string `json:"room_id"`
-	Username string `json:"username"`
+	Type     string           `json:"type,omitempty"`
+	Code     string           `json:"code,omitempty"`
+	Seq      int64            `json:"seq,omitempty"`
+	ClientID string           `json:"client_id,omitempty"`
+	Content  string           `json:"content"`
+	RoomID   string           `json:"room_id"`
+	UserID   string           `json:"user_id,omitempty"`
+	Username string           `json:"username"`
+	Modes    *model.RoomModes `json:"modes,omitempty"`
+	// RetryAfter is in milliseconds.
+	RetryAfter int64 `json:"retry_after_ms,omitempty"`
+
+	sender *Client
+	// encodings caches the message in each encoding it has been sent in.
+	encodings [numEncodings]encoded
 }
 
-func (c *Client) WriteMessage() {
-	defer func() {
-		c.Conn.Close()
-	}()
+// inbound is a frame sent by a client. Frames that are not JSON objects are
+// treated as the content of a chat message, as is JSON without a type.
+// RoomID may be left out on a connection subscribed to a single room.
+type inbound struct {
+	Type     string    `json:"type"`
+	RoomID   string    `json:"room_id"`
+	ClientID string    `json:"client_id"`
+	Content  string    `json:"content"`
+	Modes    ModePatch `json:"modes"`
+	Token    string    `json:"token"`
+	LastSeq  int64     `json:"last_seq"`
+}
 
-	for {
-		message, ok := <-c.Message
+func parseInbound(data []byte) inbound {
+	var in inbound
+	if err := json.Unmarshal(data, &in); err != nil {
+		return inbound{Type: MessageTypeChat, Content: string(data)}
+	}
+	if in.Type == "" {
+		in.Type = MessageTypeChat
+	}
+	return in
+}
 
-		if !ok {
-			return
-		}
+// closeWith closes the client's connection, telling the peer why.
+func (c *Client) closeWith(code int, reason string) {
+	if c.conn != nil {
+		c.conn.closeWith(code, reason)
+	}
+}
 
-		c.Conn.WriteJSON(message)
+// roomClosed ends a subscription whose room was closed. A connection left
+// without rooms is closed, as a client connected to a single room expects;
+// otherwise it is told it has been unsubscribed.
+func (c *Client) roomClosed(reason string) {
+	if c.conn == nil || !c.conn.remove(c) {
+		return
+	}
+	if c.conn.Rooms != nil {
+		c.conn.Rooms.Leave(c)
 	}
+
+	if c.conn.roomCount() == 0 {
+		c.conn.closeWith(CloseRoomClosed, reason)
+		return
+	}
+	c.trySend(&Message{
+		Type:    MessageTypeUnsubscribed,
+		Code:    ErrorCodeRoomClosed,
+		Content: reason,
+		RoomID:  c.RoomID,
+	})
 }
 
-func (c *Client) ReadMessage(hub *Hub) {
-	defer func() {
-		hub.Unregister <- c
-		c.Conn.Close()
-	}()
+// sendError tells the client why its request failed. The error is dropped
+// if the client's buffer is full, as it is already falling behind.
+func (c *Client) sendError(code, reason string) {
+	c.reject("", code, reason)
+}
 
-	for {
-		_, m, err := c.Conn.ReadMessage()
-		if err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Printf("error: %v", err)
-			}
-		}
+// reject tells the client why the message it sent as clientID failed.
+func (c *Client) reject(clientID, code, reason string) {
+	c.trySend(&Message{
+		Type:     MessageTypeError,
+		Code:     code,
+		ClientID: clientID,
+		Content:  reason,
+		RoomID:   c.RoomID,
+	})
+}
 
-		msg := &Message{
-			Content:  string(m),
-			RoomID:   c.RoomID,
-			Username: c.Username,
-		}
+// ack tells the client the message it sent as clientID was accepted and
+// numbered seq.
+func (c *Client) ack(clientID string, seq int64) {
+	c.trySend(&Message{
+		Type:     MessageTypeAck,
+		Seq:      seq,
+		ClientID: clientID,
+		RoomID:   c.RoomID,
+	})
+}
 
-		hub.Broadcast <- msg
+func (c *Client) trySend(m *Message) {
+	select {
+	case c.Message <- m:
+	default:
 	}
-
 }
@@ -0,0 +1,496 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/kamdyns/movie-chat/internal/apperr"
+	"github.com/kamdyns/movie-chat/internal/filter"
+	"github.com/kamdyns/movie-chat/internal/ratelimit"
+)
+
+// Subscriptions decides which rooms a connection may join. Join checks the
+// user may subscribe to roomID and returns the Client to register for it,
+// or an error saying why not. Leave is called once for every Client Join
+// returned, after it has left the room.
+type Subscriptions interface {
+	Join(ctx context.Context, roomID string) (*Client, error)
+	Leave(cl *Client)
+}
+
+// Connection is a user's websocket. It can be subscribed to several rooms
+// at once, each through its own Client, and every message it sends or
+// receives names its room.
+//
+// Transports other than websockets, such as server-sent events, use a
+// Connection without Conn. They call Open and Close themselves, and read
+// Message until Done is closed.
+type Connection struct {
+	Conn     *websocket.Conn
+	Message  chan *Message
+	UserID   string
+	Username string
+	// Encoding is how messages are written to Conn, JSON unless the client
+	// negotiated another with a subprotocol.
+	Encoding Encoding
+	// CompressionThreshold is the size in bytes from which messages are
+	// compressed, if the connection negotiated compression.
+	CompressionThreshold int
+
+	// SessionID and ExpiresAt come from the token the connection was opened
+	// with. The connection is closed once ExpiresAt passes.
+	SessionID string
+	ExpiresAt time.Time
+
+	// Rooms authorizes subscribe requests. Without it the connection stays
+	// in the rooms it was served with.
+	Rooms Subscriptions
+
+	mu   sync.Mutex
+	subs map[string]*Client
+
+	expiry      *time.Timer
+	expiryGrace time.Duration
+	// done is closed once the connection is closed, which stops the
+	// writer. Message is never closed, so sending to it is always safe.
+	done        chan struct{}
+	closeOnce   sync.Once
+	restartOnce sync.Once
+	writeWait   time.Duration
+	// closeCode and closeReason are why the server closed the connection.
+	closeCode   int
+	closeReason string
+}
+
+// Serve subscribes the connection to rooms and relays messages until it
+// closes, it is disconnected, ctx is cancelled or the Hub stops. Every
+// subscription has been left by the time it returns.
+func (c *Connection) Serve(ctx context.Context, hub *Hub, rooms ...*Client) {
+	if !c.Open(hub, rooms...) {
+		return
+	}
+	defer c.Close(hub)
+
+	go c.writeMessages(ctx, hub.KeepAlive)
+	c.readMessages(ctx, hub)
+}
+
+// Open subscribes the connection to rooms. It reports false if the Hub has
+// stopped, in which case the connection has been closed again.
+func (c *Connection) Open(hub *Hub, rooms ...*Client) bool {
+	c.done = make(chan struct{})
+	c.subs = make(map[string]*Client)
+	c.writeWait = hub.KeepAlive.WriteWait
+
+	metrics.connections.Add(1)
+	hub.clients.Add(1)
+	c.watchExpiry(hub.ExpiryGrace)
+
+	// Every room is added before any is registered, so Close leaves all
+	// of them if the Hub has stopped.
+	for _, cl := range rooms {
+		c.add(cl)
+	}
+	for _, cl := range rooms {
+		if !hub.Register(cl) {
+			c.closeWith(websocket.CloseGoingAway, "Server shutting down")
+			c.Close(hub)
+			return false
+		}
+	}
+	return true
+}
+
+// Close leaves every room the connection is still in and closes it.
+func (c *Connection) Close(hub *Hub) {
+	c.stopExpiry()
+	for _, cl := range c.removeAll() {
+		hub.Unregister(cl)
+		if c.Rooms != nil {
+			c.Rooms.Leave(cl)
+		}
+	}
+	c.close()
+	metrics.connections.Add(-1)
+	hub.clients.Add(-1)
+}
+
+// Done is closed once the connection has been closed.
+func (c *Connection) Done() <-chan struct{} {
+	return c.done
+}
+
+// CloseReason returns the close code and reason the server closed the
+// connection with, or zero if it has not.
+func (c *Connection) CloseReason() (int, string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.closeCode, c.closeReason
+}
+
+// add makes cl one of the connection's rooms.
+func (c *Connection) add(cl *Client) {
+	cl.conn = c
+	cl.Message = c.Message
+	cl.ID = c.UserID
+	cl.Username = c.Username
+	cl.SessionID = c.SessionID
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.subs[cl.RoomID] = cl
+}
+
+// room returns the subscription a message is for. A message without a room
+// goes to the only room the connection is subscribed to, if there is just
+// one.
+func (c *Connection) room(roomID string) (*Client, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if roomID == "" && len(c.subs) == 1 {
+		for _, cl := range c.subs {
+			return cl, true
+		}
+	}
+	cl, ok := c.subs[roomID]
+	return cl, ok
+}
+
+func (c *Connection) roomCount() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.subs)
+}
+
+// remove drops cl from the connection's rooms. It reports false if cl had
+// already been removed, so only one caller goes on to clean up after it.
+func (c *Connection) remove(cl *Client) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.subs[cl.RoomID] != cl {
+		return false
+	}
+	delete(c.subs, cl.RoomID)
+	return true
+}
+
+func (c *Connection) removeAll() []*Client {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	clients := make([]*Client, 0, len(c.subs))
+	for id, cl := range c.subs {
+		clients = append(clients, cl)
+		delete(c.subs, id)
+	}
+	return clients
+}
+
+// close closes the connection, which ends the read loop, and stops the
+// writer. It is safe to call more than once and from any goroutine.
+func (c *Connection) close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		if c.Conn != nil {
+			c.Conn.Close()
+		}
+	})
+}
+
+// writeMessages sends queued messages and keeps the connection alive with
+// pings. A write that misses its deadline means the peer has stopped
+// reading, and the connection is dropped.
+func (c *Connection) writeMessages(ctx context.Context, keepAlive KeepAlive) {
+	defer c.close()
+
+	ping := time.NewTicker(keepAlive.PingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case message := <-c.Message:
+			enc := message.encode(c.Encoding)
+			if enc.err != nil {
+				log.Printf("failed to encode %s message as %s: %v", message.Type, c.Encoding, enc.err)
+				continue
+			}
+			c.Conn.EnableWriteCompression(len(enc.data) >= c.CompressionThreshold)
+			c.Conn.SetWriteDeadline(time.Now().Add(keepAlive.WriteWait))
+			if err := c.Conn.WritePreparedMessage(enc.prepared); err != nil {
+				c.writeFailed(err)
+				return
+			}
+			if message.Type == MessageTypeRestart {
+				c.closeWith(websocket.CloseServiceRestart, "Server restarting")
+				return
+			}
+		case <-ping.C:
+			if err := c.Conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(keepAlive.WriteWait)); err != nil {
+				c.writeFailed(err)
+				return
+			}
+		case <-c.done:
+			return
+		case <-ctx.Done():
+			c.closeWith(websocket.CloseGoingAway, "Connection closed")
+			return
+		}
+	}
+}
+
+func (c *Connection) writeFailed(err error) {
+	if isTimeout(err) {
+		metrics.stalePruned.Add(1)
+		log.Printf("dropping stale connection of %s: write timed out", c.UserID)
+	}
+}
+
+// readMessages handles the connection's frames until it fails or is
+// closed, from either end. Every frame and pong pushes the read deadline
+// out, so a peer that goes silent for PongWait is dropped.
+func (c *Connection) readMessages(ctx context.Context, hub *Hub) {
+	pongWait := hub.KeepAlive.PongWait
+	c.Conn.SetReadLimit(hub.KeepAlive.MaxMessageSize)
+	c.Conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.Conn.SetPongHandler(func(string) error {
+		return c.Conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	limiter := ratelimit.NewBucket(hub.Limits.ClientRate, hub.Limits.ClientBurst)
+	violations := 0
+
+	for {
+		kind, m, err := c.Conn.ReadMessage()
+		if err != nil {
+			switch {
+			case errors.Is(err, websocket.ErrReadLimit):
+				metrics.oversizedMessages.Add(1)
+			case isTimeout(err):
+				metrics.stalePruned.Add(1)
+				log.Printf("dropping stale connection of %s: no pong within %s", c.UserID, pongWait)
+			case websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseAbnormalClosure):
+				log.Printf("websocket read from %s failed: %v", c.UserID, err)
+			}
+			return
+		}
+		c.Conn.SetReadDeadline(time.Now().Add(pongWait))
+
+		var in inbound
+		if kind == websocket.BinaryMessage {
+			in, err = unmarshalInbound(m)
+		} else {
+			in = parseInbound(m)
+		}
+
+		if err != nil {
+			c.sendError("", ErrorCodeInvalid, "Binary frames must be MessagePack")
+			continue
+		}
+
+		switch in.Type {
+		case MessageTypeAuth:
+			c.reauthenticate(hub, in.Token)
+			continue
+		case MessageTypeSubscribe:
+			c.join(ctx, hub, in)
+			continue
+		case MessageTypeUnsubscribe:
+			c.leave(hub, in.RoomID)
+			continue
+		case MessageTypeChat, MessageTypeMode:
+		default:
+			c.sendError(in.RoomID, ErrorCodeInvalid, "Unknown message type "+in.Type)
+			continue
+		}
+
+		// Only chat and mode changes count towards the rate limit, so
+		// subscribing to rooms or refreshing the token never gets a
+		// connection limited or dropped.
+		if !limiter.Allow() {
+			violations++
+			if hub.Limits.MaxViolations > 0 && violations >= hub.Limits.MaxViolations {
+				c.closeWithPolicyViolation("Rate limit exceeded")
+				return
+			}
+			c.reject(in.RoomID, in.ClientID, ErrorCodeRateLimited, "You are sending messages too quickly")
+			continue
+		}
+
+		cl, ok := c.room(in.RoomID)
+		if !ok {
+			c.reject(in.RoomID, in.ClientID, ErrorCodeNotSubscribed, "Subscribe to the room first")
+			continue
+		}
+
+		if in.Type == MessageTypeMode {
+			cl.requestModeChange(hub, in.Modes)
+			continue
+		}
+
+		hub.chat(cl, in.ClientID, in.Content)
+	}
+}
+
+// join subscribes the connection to another room, if the user may enter
+// it. The room's join notice, sent to the connection like everyone else,
+// confirms it.
+func (c *Connection) join(ctx context.Context, hub *Hub, in inbound) {
+	if c.Rooms == nil {
+		c.sendError(in.RoomID, ErrorCodeForbidden, "This connection cannot join other rooms")
+		return
+	}
+	if in.RoomID == "" {
+		c.sendError("", ErrorCodeInvalid, "room_id is required")
+		return
+	}
+	if _, ok := c.room(in.RoomID); ok {
+		c.sendError(in.RoomID, ErrorCodeInvalid, "Already subscribed to the room")
+		return
+	}
+
+	cl, err := c.Rooms.Join(ctx, in.RoomID)
+	if err != nil {
+		e := apperr.From(err)
+		c.sendError(in.RoomID, e.Code, e.Message)
+		return
+	}
+	cl.RoomID = in.RoomID
+	cl.LastSeq = in.LastSeq
+
+	c.add(cl)
+	if !hub.Register(cl) && c.remove(cl) {
+		c.Rooms.Leave(cl)
+	}
+}
+
+// leave unsubscribes the connection from a room. The rest of the room is
+// told it left.
+func (c *Connection) leave(hub *Hub, roomID string) {
+	cl, ok := c.room(roomID)
+	if !ok || !c.remove(cl) {
+		c.sendError(roomID, ErrorCodeNotSubscribed, "Not subscribed to the room")
+		return
+	}
+
+	hub.Unregister(cl)
+	if c.Rooms != nil {
+		c.Rooms.Leave(cl)
+	}
+	c.trySend(&Message{Type: MessageTypeUnsubscribed, RoomID: cl.RoomID})
+}
+
+func (c *Client) requestModeChange(hub *Hub, patch ModePatch) {
+	if !c.IsModerator {
+		c.sendError(ErrorCodeForbidden, "Only moderators can change room modes")
+		return
+	}
+	if n := patch.SlowModeSeconds; n != nil && (*n < 0 || *n > maxSlowModeSeconds) {
+		c.sendError(ErrorCodeInvalid, fmt.Sprintf("Slow mode must be between 0 and %d seconds", maxSlowModeSeconds))
+		return
+	}
+
+	select {
+	case hub.shardFor(c.RoomID).modeChanges <- &modeChange{client: c, patch: patch}:
+	case <-hub.done:
+	}
+}
+
+// chat checks a chat message from cl and broadcasts it. If it is rejected
+// cl is told why.
+func (h *Hub) chat(cl *Client, clientID, content string) {
+	if !h.roomLimiter.Allow(cl.RoomID) {
+		cl.reject(clientID, ErrorCodeRoomBusy, "The room is busy, please try again shortly")
+		return
+	}
+
+	res := h.Filters.Run(&filter.Message{
+		UserID:  cl.ID,
+		RoomID:  cl.RoomID,
+		Content: content,
+	})
+	if res.Action == filter.Reject {
+		cl.reject(clientID, ErrorCodeRejected, res.Reason)
+		return
+	}
+
+	h.Broadcast(&Message{
+		Type:     MessageTypeChat,
+		ClientID: clientID,
+		Content:  res.Content,
+		RoomID:   cl.RoomID,
+		UserID:   cl.ID,
+		Username: cl.Username,
+		sender:   cl,
+	})
+}
+
+// Post sends a chat message from a client that is not registered, for
+// transports that send over plain HTTP, and waits for the outcome. It
+// returns the ack, or the error explaining why the message was rejected.
+// Posts count towards the client rate limit per user rather than per
+// connection. The client's Message channel is replaced.
+func (h *Hub) Post(ctx context.Context, cl *Client, clientID, content string) (*Message, error) {
+	if !h.postLimiter.Allow(cl.ID) {
+		return &Message{
+			Type:     MessageTypeError,
+			Code:     ErrorCodeRateLimited,
+			ClientID: clientID,
+			Content:  "You are sending messages too quickly",
+			RoomID:   cl.RoomID,
+		}, nil
+	}
+
+	cl.Message = make(chan *Message, 1)
+	h.chat(cl, clientID, content)
+
+	select {
+	case m := <-cl.Message:
+		return m, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-h.done:
+		return nil, errHubStopped
+	}
+}
+
+// sendError tells the connection why a request failed. The error is
+// dropped if its buffer is full, as it is already falling behind.
+func (c *Connection) sendError(roomID, code, reason string) {
+	c.reject(roomID, "", code, reason)
+}
+
+// reject tells the connection why the message it sent as clientID failed.
+func (c *Connection) reject(roomID, clientID, code, reason string) {
+	c.trySend(&Message{
+		Type:     MessageTypeError,
+		Code:     code,
+		ClientID: clientID,
+		Content:  reason,
+		RoomID:   roomID,
+	})
+}
+
+func (c *Connection) trySend(m *Message) {
+	select {
+	case c.Message <- m:
+	default:
+	}
+}
+
+// closeWithPolicyViolation tells the peer why it is being dropped. Control
+// frames may be written concurrently with WriteMessage, so this is safe to
+// call from the read loop.
+func (c *Connection) closeWithPolicyViolation(reason string) {
+	msg := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, reason)
+	c.Conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(c.writeWait))
+}
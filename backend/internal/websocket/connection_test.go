@@ -0,0 +1,357 @@
+package websocket
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/kamdyns/movie-chat/internal/filter"
+	"github.com/kamdyns/movie-chat/internal/model"
+)
+
+// memStore keeps saved messages in memory.
+type memStore struct {
+	mu   sync.Mutex
+	msgs []model.Message
+}
+
+func (s *memStore) SaveMessage(ctx context.Context, msg *model.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.msgs = append(s.msgs, *msg)
+	return nil
+}
+
+func (s *memStore) MessagesAfter(ctx context.Context, roomID string, afterSeq int64, limit int) ([]model.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var after []model.Message
+	for _, m := range s.msgs {
+		if m.RoomID == roomID && m.Seq > afterSeq && len(after) < limit {
+			after = append(after, m)
+		}
+	}
+	return after, nil
+}
+
+func (s *memStore) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.msgs)
+}
+
+// testServer serves websockets from a Hub the way the handler does, one
+// room per connection, taking the user and room from the query string.
+type testServer struct {
+	hub   *Hub
+	store *memStore
+	url   string
+
+	mu    sync.Mutex
+	conns map[string]*Connection
+}
+
+func newTestServer(t *testing.T, opts Options) *testServer {
+	t.Helper()
+	s := &testServer{store: &memStore{}, conns: make(map[string]*Connection)}
+	opts.Messages = s.store
+	opts.Filters = filter.NewChain()
+	if opts.Limits == (RateLimits{}) {
+		opts.Limits = RateLimits{ClientRate: 1000, ClientBurst: 1000, RoomRate: 1000, RoomBurst: 1000}
+	}
+	s.hub = NewHub(opts)
+	ctx, cancel := context.WithCancel(context.Background())
+	go s.hub.Run(ctx)
+
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		if r.URL.Query().Has("small") {
+			conn.UnderlyingConn().(*net.TCPConn).SetWriteBuffer(4096)
+		}
+
+		user := r.URL.Query().Get("user")
+		c := &Connection{Conn: conn, Message: make(chan *Message, s.hub.SendBuffer), UserID: user, Username: user}
+		s.mu.Lock()
+		s.conns[user] = c
+		s.mu.Unlock()
+		c.Serve(r.Context(), s.hub, &Client{RoomID: r.URL.Query().Get("room"), IsMember: true})
+	}))
+	s.url = "ws" + strings.TrimPrefix(srv.URL, "http")
+	t.Cleanup(func() {
+		srv.Close()
+		cancel()
+		<-s.hub.stopped
+	})
+	return s
+}
+
+func (s *testServer) dial(t *testing.T, user, room string) *websocket.Conn {
+	t.Helper()
+	return s.dialWith(t, websocket.DefaultDialer, s.url+"?user="+user+"&room="+room)
+}
+
+// dialSmall connects with small socket buffers on both ends, so a client
+// that stops reading backs up into the Hub quickly.
+func (s *testServer) dialSmall(t *testing.T, user, room string) *websocket.Conn {
+	t.Helper()
+	dialer := *websocket.DefaultDialer
+	dialer.NetDialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := (&net.Dialer{}).DialContext(ctx, network, addr)
+		if err == nil {
+			conn.(*net.TCPConn).SetReadBuffer(4096)
+		}
+		return conn, err
+	}
+	return s.dialWith(t, &dialer, s.url+"?user="+user+"&room="+room+"&small")
+}
+
+func (s *testServer) dialWith(t *testing.T, dialer *websocket.Dialer, url string) *websocket.Conn {
+	t.Helper()
+	conn, _, err := dialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// connection returns the server side of user's connection.
+func (s *testServer) connection(user string) *Connection {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.conns[user]
+}
+
+// readUntil reads from conn until a message matches, failing if none does
+// within a few seconds.
+func readUntil(t *testing.T, conn *websocket.Conn, match func(*Message) bool) *Message {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		var m Message
+		if err := conn.ReadJSON(&m); err != nil {
+			t.Fatalf("no matching message: %v", err)
+		}
+		if match(&m) {
+			return &m
+		}
+	}
+}
+
+func presence(kind, user string) func(*Message) bool {
+	return func(m *Message) bool { return m.Type == kind && m.UserID == user }
+}
+
+// waitForClients waits until roomID has n clients on this instance, as
+// Register and Unregister return before the shard has acted on them.
+func waitForClients(t *testing.T, hub *Hub, roomID string, n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for hub.ConnectionCounts()[roomID] != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("room %s never had %d clients", roomID, n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestJoinAndLeave(t *testing.T) {
+	s := newTestServer(t, Options{})
+
+	a := s.dial(t, "a", "r")
+	readUntil(t, a, presence(MessageTypeJoin, "a"))
+	b := s.dial(t, "b", "r")
+	readUntil(t, b, presence(MessageTypeJoin, "b"))
+	readUntil(t, a, presence(MessageTypeJoin, "b"))
+
+	b.WriteJSON(map[string]string{"content": "hello", "client_id": "1"})
+	if m := readUntil(t, a, func(m *Message) bool { return m.Type == MessageTypeChat }); m.Content != "hello" || m.UserID != "b" {
+		t.Fatalf("got %+v", m)
+	}
+	if m := readUntil(t, b, func(m *Message) bool { return m.Type == MessageTypeAck }); m.ClientID != "1" || m.Seq == 0 {
+		t.Fatalf("got %+v, want an ack", m)
+	}
+
+	b.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	readUntil(t, a, presence(MessageTypeLeave, "b"))
+	waitForClients(t, s.hub, "r", 1)
+}
+
+// Frames other than chat and mode changes are not rate limited, so a
+// client managing its subscriptions can still chat.
+func TestOnlyChatIsRateLimited(t *testing.T) {
+	s := newTestServer(t, Options{
+		Limits: RateLimits{ClientRate: 0.001, ClientBurst: 1, RoomRate: 1000, RoomBurst: 1000, MaxViolations: 2},
+	})
+
+	a := s.dial(t, "a", "r")
+	readUntil(t, a, presence(MessageTypeJoin, "a"))
+	for i := 0; i < 5; i++ {
+		a.WriteJSON(map[string]string{"type": MessageTypeUnsubscribe, "room_id": "other"})
+		if m := readUntil(t, a, func(m *Message) bool { return m.Type == MessageTypeError }); m.Code != ErrorCodeNotSubscribed {
+			t.Fatalf("got %+v, want not subscribed", m)
+		}
+	}
+
+	a.WriteJSON(map[string]string{"content": "hello", "client_id": "1"})
+	if m := readUntil(t, a, func(m *Message) bool { return m.Type == MessageTypeAck || m.Type == MessageTypeError }); m.Type != MessageTypeAck {
+		t.Fatalf("got %+v, want an ack", m)
+	}
+	a.WriteJSON(map[string]string{"content": "again", "client_id": "2"})
+	if m := readUntil(t, a, func(m *Message) bool { return m.Type == MessageTypeError }); m.Code != ErrorCodeRateLimited || m.ClientID != "2" {
+		t.Fatalf("got %+v, want the second message rate limited", m)
+	}
+}
+
+// A client that vanishes without a close frame while the room is busy is
+// dropped, and nobody else misses anything.
+func TestAbruptDropMidBroadcast(t *testing.T) {
+	s := newTestServer(t, Options{SendBuffer: 256})
+
+	sender := s.dial(t, "sender", "r")
+	readUntil(t, sender, presence(MessageTypeJoin, "sender"))
+	dropped := s.dial(t, "dropped", "r")
+	readUntil(t, dropped, presence(MessageTypeJoin, "dropped"))
+	watcher := s.dial(t, "watcher", "r")
+	readUntil(t, watcher, presence(MessageTypeJoin, "watcher"))
+	waitForClients(t, s.hub, "r", 3)
+
+	const n = 200
+	go func() {
+		for i := 0; i < n; i++ {
+			sender.WriteJSON(map[string]string{"content": "message"})
+			if i == n/2 {
+				dropped.UnderlyingConn().Close()
+			}
+		}
+	}()
+
+	var last int64
+	left := false
+	for got := 0; got < n; {
+		m := readUntil(t, watcher, func(m *Message) bool {
+			return m.Type == MessageTypeChat || m.Type == MessageTypeLeave
+		})
+		if m.Type == MessageTypeLeave {
+			left = left || m.UserID == "dropped"
+			continue
+		}
+		if m.Seq <= last {
+			t.Fatalf("got seq %d after %d", m.Seq, last)
+		}
+		last = m.Seq
+		got++
+	}
+	if !left {
+		readUntil(t, watcher, presence(MessageTypeLeave, "dropped"))
+	}
+	waitForClients(t, s.hub, "r", 2)
+}
+
+func TestSlowConsumerIsDisconnected(t *testing.T) {
+	s := newTestServer(t, Options{
+		SendBuffer:    16,
+		SlowConsumers: SlowConsumerPolicy{Action: SlowConsumerDisconnect},
+		KeepAlive:     KeepAlive{WriteWait: time.Second},
+	})
+
+	fast := s.dial(t, "fast", "r")
+	readUntil(t, fast, presence(MessageTypeJoin, "fast"))
+	s.dialSmall(t, "slow", "r") // never read
+	readUntil(t, fast, presence(MessageTypeJoin, "slow"))
+
+	// Big messages fill the slow client's socket, then its queue.
+	content := strings.Repeat("x", 4000)
+	const n = 100
+	received := make(chan error, 1)
+	go func() {
+		for got := 0; got < n; {
+			var m Message
+			if err := fast.ReadJSON(&m); err != nil {
+				received <- err
+				return
+			}
+			if m.Type == MessageTypeChat {
+				got++
+			}
+		}
+		received <- nil
+	}()
+	for i := 0; i < n; i++ {
+		fast.WriteJSON(map[string]string{"content": content})
+		time.Sleep(time.Millisecond)
+	}
+
+	fast.SetReadDeadline(time.Now().Add(10 * time.Second))
+	select {
+	case err := <-received:
+		if err != nil {
+			t.Fatalf("fast client: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("the fast client was held up by the slow one")
+	}
+	waitForClients(t, s.hub, "r", 1)
+	if code, _ := s.connection("slow").CloseReason(); code != CloseSlowConsumer {
+		t.Fatalf("slow client closed with %d, want %d", code, CloseSlowConsumer)
+	}
+}
+
+// Shutdown tells every client to reconnect, closes them with 1012 and
+// saves every message accepted before it returns.
+func TestShutdownDrainsConnections(t *testing.T) {
+	s := newTestServer(t, Options{ReconnectJitter: time.Second})
+
+	var conns []*websocket.Conn
+	for _, room := range []string{"a", "b", "c"} {
+		for _, user := range []string{"1", "2", "3"} {
+			conns = append(conns, s.dial(t, user+room, room))
+		}
+	}
+	for _, room := range []string{"a", "b", "c"} {
+		waitForClients(t, s.hub, room, 3)
+	}
+
+	const n = 50
+	for i := 0; i < n; i++ {
+		conns[0].WriteJSON(map[string]string{"content": "before shutdown"})
+	}
+	readUntil(t, conns[1], func(m *Message) bool { return m.Type == MessageTypeChat && m.Seq == n })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	errc := make(chan error, 1)
+	go func() { errc <- s.hub.Shutdown(ctx) }()
+
+	for i, conn := range conns {
+		restart := readUntil(t, conn, func(m *Message) bool { return m.Type == MessageTypeRestart })
+		if restart.RetryAfter < 0 || restart.RetryAfter >= 1000 {
+			t.Errorf("conn %d: retry after %dms, want under a second", i, restart.RetryAfter)
+		}
+		_, _, err := conn.ReadMessage()
+		if !websocket.IsCloseError(err, websocket.CloseServiceRestart) {
+			t.Fatalf("conn %d: got %v, want a restart close", i, err)
+		}
+	}
+
+	if err := <-errc; err != nil {
+		t.Fatalf("Shutdown() = %v", err)
+	}
+	if got := s.store.count(); got != n {
+		t.Fatalf("saved %d messages, want %d", got, n)
+	}
+}
@@ -0,0 +1,124 @@
+package websocket
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// ProtocolMsgPack is the subprotocol a client offers to receive MessagePack
+// instead of JSON. Without it, connections use JSON.
+const ProtocolMsgPack = "movie-chat.msgpack"
+
+// Encoding is a wire format for messages. MessagePack uses the same field
+// names as JSON, so both describe the same messages.
+type Encoding int
+
+const (
+	EncodingJSON Encoding = iota
+	EncodingMsgPack
+
+	numEncodings
+)
+
+// EncodingFor returns the encoding a connection negotiated with subprotocol.
+func EncodingFor(subprotocol string) Encoding {
+	if subprotocol == ProtocolMsgPack {
+		return EncodingMsgPack
+	}
+	return EncodingJSON
+}
+
+// ParseEncoding returns the encoding called name, as printed by String.
+func ParseEncoding(name string) (Encoding, bool) {
+	for e := EncodingJSON; e < numEncodings; e++ {
+		if e.String() == name {
+			return e, true
+		}
+	}
+	return 0, false
+}
+
+func (e Encoding) String() string {
+	if e == EncodingMsgPack {
+		return "msgpack"
+	}
+	return "json"
+}
+
+// frameType is the websocket frame type messages in e are sent as.
+func (e Encoding) frameType() int {
+	if e == EncodingMsgPack {
+		return websocket.BinaryMessage
+	}
+	return websocket.TextMessage
+}
+
+// Marshal encodes m. Connections use Message.Encode instead, which encodes
+// each message once however many clients receive it.
+func (e Encoding) Marshal(m *Message) ([]byte, error) {
+	if e == EncodingMsgPack {
+		var buf bytes.Buffer
+		enc := msgpack.GetEncoder()
+		defer msgpack.PutEncoder(enc)
+
+		enc.Reset(&buf)
+		enc.SetCustomStructTag("json")
+		enc.UseCompactInts(true)
+		if err := enc.Encode(m); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	return json.Marshal(m)
+}
+
+// unmarshalInbound decodes a binary frame. Unlike text frames, one that
+// does not decode is an error rather than chat content.
+func unmarshalInbound(data []byte) (inbound, error) {
+	var in inbound
+	dec := msgpack.GetDecoder()
+	defer msgpack.PutDecoder(dec)
+
+	dec.Reset(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	if err := dec.Decode(&in); err != nil {
+		return inbound{}, err
+	}
+	if in.Type == "" {
+		in.Type = MessageTypeChat
+	}
+	return in, nil
+}
+
+// encoded is a message in one encoding, made the first time a client that
+// uses it is sent the message.
+type encoded struct {
+	once     sync.Once
+	data     []byte
+	prepared *websocket.PreparedMessage
+	err      error
+}
+
+// Encode returns m in encoding e. The result is shared by everyone m is
+// sent to, so neither m nor the result may be changed afterwards.
+func (m *Message) Encode(e Encoding) ([]byte, error) {
+	enc := m.encode(e)
+	return enc.data, enc.err
+}
+
+// encode returns m in encoding e. Its prepared message also caches the
+// frames, compressed or not, that connections write.
+func (m *Message) encode(e Encoding) *encoded {
+	enc := &m.encodings[e]
+	enc.once.Do(func() {
+		enc.data, enc.err = e.Marshal(m)
+		if enc.err == nil {
+			enc.prepared, enc.err = websocket.NewPreparedMessage(e.frameType(), enc.data)
+		}
+	})
+	return enc
+}
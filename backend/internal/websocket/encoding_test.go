@@ -0,0 +1,51 @@
+package websocket
+
+import (
+	"fmt"
+	"testing"
+)
+
+func benchmarkMessage() *Message {
+	return &Message{
+		Type:     MessageTypeChat,
+		Seq:      12345,
+		RoomID:   "room_2abcdefghijklmnopqrstuvwxyz",
+		UserID:   "user_2abcdefghijklmnopqrstuvwxyz",
+		Username: "benchmark",
+		Content:  "benchmark message",
+	}
+}
+
+// BenchmarkEncode measures encoding a chat message for a room of clients,
+// either once and shared as connections do or separately for each client.
+// An op is one message sent to the whole room; wire-B/op is the bytes it
+// takes on the wire, before compression.
+func BenchmarkEncode(b *testing.B) {
+	for _, clients := range []int{1, 20, 100} {
+		for _, e := range []Encoding{EncodingJSON, EncodingMsgPack} {
+			name := fmt.Sprintf("%s/clients=%d", e, clients)
+			b.Run(name+"/cached", func(b *testing.B) {
+				benchmarkEncode(b, clients, func(m *Message) ([]byte, error) { return m.Encode(e) })
+			})
+			b.Run(name+"/per-client", func(b *testing.B) {
+				benchmarkEncode(b, clients, e.Marshal)
+			})
+		}
+	}
+}
+
+func benchmarkEncode(b *testing.B, clients int, encode func(*Message) ([]byte, error)) {
+	b.ReportAllocs()
+	var written int
+	for i := 0; i < b.N; i++ {
+		m := benchmarkMessage()
+		for c := 0; c < clients; c++ {
+			data, err := encode(m)
+			if err != nil {
+				b.Fatal(err)
+			}
+			written += len(data)
+		}
+	}
+	b.ReportMetric(float64(written)/float64(b.N), "wire-B/op")
+}
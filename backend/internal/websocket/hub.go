@@ -1,59 +1,400 @@
 package websocket
 
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"log"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kamdyns/movie-chat/internal/auth"
+	"github.com/kamdyns/movie-chat/internal/backplane"
+	"github.com/kamdyns/movie-chat/internal/filter"
+	"github.com/kamdyns/movie-chat/internal/model"
+	"github.com/kamdyns/movie-chat/internal/ratelimit"
+)
+
+var errHubStopped = errors.New("websocket: hub stopped")
+
 type Room struct {
-	ID      string             `json:"id"`
-	Name    string             `json:"name"`
-	Clients map[string]*Client `json:"clients"`
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Clients is keyed by connection, as a user may join from several
+	// tabs at once.
+	Clients map[*Client]bool `json:"-"`
+	Modes   model.RoomModes  `json:"modes"`
+
+	lastMessageAt map[string]time.Time
+	// lastSeq is the number of the last chat message delivered here, and
+	// replay holds the latest of them.
+	lastSeq int64
+	replay  *replayLog
+	// subscribed is set once the Hub listens on the room's channel. Until
+	// then the clients that joined wait in waiting, and are only told
+	// about the room once they can see what happens in it, and messages
+	// posted to it wait in deferred, so they are not published before
+	// this instance can receive them.
+	subscribed bool
+	waiting    []*Client
+	deferred   []*Message
+	// emptied counts the times the room was left without clients, so the
+	// timer that drops it can tell whether it has been used since.
+	emptied int
+}
+
+func newRoom(id string, info *model.Room, replaySize int) *Room {
+	r := &Room{
+		ID:            id,
+		Clients:       make(map[*Client]bool),
+		lastMessageAt: make(map[string]time.Time),
+		replay:        newReplayLog(replaySize),
+	}
+	if info != nil {
+		r.Name = info.Name
+		r.Modes = info.Modes
+	}
+	return r
+}
+
+// RoomStore persists room state changed over the websocket.
+type RoomStore interface {
+	UpdateRoomModes(ctx context.Context, roomID string, modes model.RoomModes) error
+}
+
+// MessageStore persists chat messages once they have been accepted, and
+// reads back the ones a reconnecting client missed.
+type MessageStore interface {
+	SaveMessage(ctx context.Context, msg *model.Message) error
+	MessagesAfter(ctx context.Context, roomID string, afterSeq int64, limit int) ([]model.Message, error)
+}
+
+// RateLimits bounds how fast chat messages are accepted. Client limits apply
+// per connection and room limits to the combined traffic of a room. A client
+// that exceeds its limit MaxViolations times is disconnected.
+type RateLimits struct {
+	ClientRate    float64
+	ClientBurst   int
+	RoomRate      float64
+	RoomBurst     int
+	MaxViolations int
+}
+
+const (
+	SlowConsumerDrop       = "drop"
+	SlowConsumerDisconnect = "disconnect"
+)
+
+// SlowConsumerPolicy decides what happens to a client whose send buffer is
+// full when a message arrives for it. With SlowConsumerDrop the client
+// misses the message, and is disconnected once it has missed MaxDropped in
+// a row, if MaxDropped is set. With SlowConsumerDisconnect it is
+// disconnected straight away. Either way the rest of the room is never kept
+// waiting.
+type SlowConsumerPolicy struct {
+	Action     string
+	MaxDropped int
+}
+
+// KeepAlive bounds how long a connection may go quiet. The server pings
+// every PingInterval and drops clients that have not answered, or sent
+// anything, within PongWait. A write that takes longer than WriteWait fails,
+// and frames larger than MaxMessageSize bytes close the connection.
+type KeepAlive struct {
+	PingInterval   time.Duration
+	PongWait       time.Duration
+	WriteWait      time.Duration
+	MaxMessageSize int64
 }
 
+func (k KeepAlive) withDefaults() KeepAlive {
+	if k.PongWait <= 0 {
+		k.PongWait = 60 * time.Second
+	}
+	if k.PingInterval <= 0 || k.PingInterval >= k.PongWait {
+		k.PingInterval = k.PongWait * 9 / 10
+	}
+	if k.WriteWait <= 0 {
+		k.WriteWait = 10 * time.Second
+	}
+	if k.MaxMessageSize <= 0 {
+		k.MaxMessageSize = 8192
+	}
+	return k
+}
+
+type Options struct {
+	Rooms    RoomStore
+	Messages MessageStore
+	Filters  *filter.Chain
+	Limits   RateLimits
+	// Auth verifies the refreshed tokens clients send to keep their
+	// connection open past the expiry of the token they connected with.
+	Auth auth.Authenticator
+	// ExpiryGrace is how long a connection stays open after its token
+	// expires, so a refreshed token sent just in time is not lost to
+	// latency. Ended sessions still close connections at once.
+	ExpiryGrace time.Duration
+	// Backplane shares rooms with other instances. Without one the Hub
+	// only serves its own clients.
+	Backplane backplane.Backplane
+	// Shards is how many goroutines rooms are spread over. It defaults to
+	// four per CPU.
+	Shards        int
+	SendBuffer    int
+	SlowConsumers SlowConsumerPolicy
+	KeepAlive     KeepAlive
+	// ReplayBuffer is how many recent chat messages each live room keeps
+	// for clients that reconnect. Older ones are read from Messages.
+	ReplayBuffer int
+	// IdleRoomTimeout is how long a room stays live once its last client
+	// has left, so long polls and posts over HTTP, which come and go, keep
+	// its replay log, slow mode and subscription. Zero drops rooms as soon
+	// as they empty.
+	IdleRoomTimeout time.Duration
+	// ReconnectJitter bounds the random delay clients are told to wait
+	// before reconnecting when the Hub shuts down.
+	ReconnectJitter time.Duration
+}
+
+// Hub tracks the live rooms on this instance. Rooms are spread over shards
+// by ID, and each shard owns its rooms and runs in its own goroutine, so
+// busy rooms only compete with the rooms that share their shard.
 type Hub struct {
-	Rooms      map[string]*Room
-	Register   chan *Client
-	Unregister chan *Client
-	Broadcast  chan *Message
+	Store     RoomStore
+	Messages  MessageStore
+	Filters   *filter.Chain
+	Limits    RateLimits
+	Auth      auth.Authenticator
+	Backplane backplane.Backplane
+	// ExpiryGrace delays closing expired connections; see Options.
+	ExpiryGrace time.Duration
+	// SendBuffer is how many messages may be queued for a client before
+	// the SlowConsumers policy applies.
+	SendBuffer      int
+	SlowConsumers   SlowConsumerPolicy
+	KeepAlive       KeepAlive
+	ReplayBuffer    int
+	IdleRoomTimeout time.Duration
+	ReconnectJitter time.Duration
+
+	shards      []*shard
+	done        chan struct{}
+	persist     chan persistJob
+	outbound    chan *outbound
+	roomLimiter *ratelimit.Limiter
+	// postLimiter applies the client rate limit to posts over HTTP, per
+	// user, as they have no connection to keep a bucket in.
+	postLimiter *ratelimit.Limiter
+
+	// quit asks Run to return, and stopped is closed once it has.
+	quit     chan struct{}
+	stopOnce sync.Once
+	stopped  chan struct{}
+	// clients counts connections being served, and pending the messages
+	// queued to be published or saved, so Shutdown knows when it is done.
+	clients atomic.Int64
+	pending atomic.Int64
+}
+
+func NewHub(opts Options) *Hub {
+	bp := opts.Backplane
+	if bp == nil {
+		bp = backplane.NewLocal(nil)
+	}
+	n := opts.Shards
+	if n <= 0 {
+		n = 4 * runtime.GOMAXPROCS(0)
+	}
+	sendBuffer := opts.SendBuffer
+	if sendBuffer <= 0 {
+		sendBuffer = 64
+	}
+	replayBuffer := opts.ReplayBuffer
+	if replayBuffer < 0 {
+		replayBuffer = 0
+	}
+
+	h := &Hub{
+		Store:           opts.Rooms,
+		Messages:        opts.Messages,
+		Filters:         opts.Filters,
+		Limits:          opts.Limits,
+		Auth:            opts.Auth,
+		Backplane:       bp,
+		ExpiryGrace:     opts.ExpiryGrace,
+		SendBuffer:      sendBuffer,
+		SlowConsumers:   opts.SlowConsumers,
+		KeepAlive:       opts.KeepAlive.withDefaults(),
+		ReplayBuffer:    replayBuffer,
+		IdleRoomTimeout: opts.IdleRoomTimeout,
+		ReconnectJitter: opts.ReconnectJitter,
+
+		shards:      make([]*shard, n),
+		done:        make(chan struct{}),
+		persist:     make(chan persistJob, 256),
+		outbound:    make(chan *outbound, 256),
+		roomLimiter: ratelimit.NewLimiter(opts.Limits.RoomRate, opts.Limits.RoomBurst),
+		postLimiter: ratelimit.NewLimiter(opts.Limits.ClientRate, opts.Limits.ClientBurst),
+		quit:        make(chan struct{}),
+		stopped:     make(chan struct{}),
+	}
+	for i := range h.shards {
+		h.shards[i] = newShard(h)
+	}
+	return h
+}
+
+// shardFor returns the shard that owns roomID.
+func (h *Hub) shardFor(roomID string) *shard {
+	f := fnv.New32a()
+	f.Write([]byte(roomID))
+	return h.shards[f.Sum32()%uint32(len(h.shards))]
+}
+
+func (h *Hub) ShardCount() int {
+	return len(h.shards)
 }
 
-func NewHub() *Hub {
-	return &Hub{
-		Rooms:      make(map[string]*Room),
-		Register:   make(chan *Client),
-		Unregister: make(chan *Client),
-		Broadcast:  make(chan *Message),
+// Register adds a client to its room and tells the room it joined. It
+// reports false if the Hub has stopped. Connection.Serve registers its
+// clients itself.
+func (h *Hub) Register(cl *Client) bool {
+	select {
+	case h.shardFor(cl.RoomID).register <- cl:
+		return true
+	case <-h.done:
+		return false
 	}
 }
 
-func (h *Hub) Run() {
+// Unregister removes a client from its room and tells the room it left.
+// Unregistering a client twice, or after the Hub stopped, does nothing.
+func (h *Hub) Unregister(cl *Client) {
+	select {
+	case h.shardFor(cl.RoomID).unregister <- cl:
+	case <-h.done:
+	}
+}
+
+// Broadcast publishes a message to everyone in its room.
+func (h *Hub) Broadcast(m *Message) {
+	select {
+	case h.shardFor(m.RoomID).broadcast <- m:
+	case <-h.done:
+	}
+}
+
+type blockChange struct {
+	UserID   string `json:"user_id"`
+	TargetID string `json:"target_id"`
+	Blocked  bool   `json:"blocked"`
+}
+
+// SetBlocked updates the block list of every connection userID has open, so
+// a block made over the REST API takes effect without reconnecting.
+func (h *Hub) SetBlocked(userID, targetID string, blocked bool) {
+	h.publish(hubChannel, &event{Kind: eventBlock, Block: &blockChange{UserID: userID, TargetID: targetID, Blocked: blocked}})
+}
+
+// Run starts the shards and hands them events from the backplane until ctx
+// is cancelled, Shutdown is called or the backplane is closed. Every client
+// is disconnected when it returns.
+func (h *Hub) Run(ctx context.Context) {
+	go h.persistMessages()
+	go h.publishEvents()
+
+	var wg sync.WaitGroup
+	for _, s := range h.shards {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.run()
+		}()
+	}
+	defer func() {
+		close(h.done)
+		wg.Wait()
+		close(h.stopped)
+	}()
+
+	h.subscribe(hubChannel)
+	messages := h.Backplane.Messages()
 	for {
 		select {
-		case cl := <-h.Register:
-			if _, ok := h.Rooms[cl.RoomID]; ok {
-				r := h.Rooms[cl.RoomID]
-
-				if _, ok := r.Clients[cl.ID]; !ok {
-					r.Clients[cl.ID] = cl
-				}
-			}
-		case cl := <-h.Unregister:
-			if _, ok := h.Rooms[cl.RoomID]; ok {
-				if _, ok := h.Rooms[cl.RoomID].Clients[cl.ID]; ok {
-					if len(h.Rooms[cl.RoomID].Clients) != 0 {
-						h.Broadcast <- &Message{
-							Content:  cl.Username + " has left the room",
-							RoomID:   cl.RoomID,
-							Username: cl.Username,
-						}
-					}
-
-					delete(h.Rooms[cl.RoomID].Clients, cl.ID)
-					close(cl.Message)
-				}
-			}
-		case m := <-h.Broadcast:
-			if _, ok := h.Rooms[m.RoomID]; ok {
-				for _, cl := range h.Rooms[m.RoomID].Clients {
-					cl.Message <- m
-				}
+		case bm, ok := <-messages:
+			if !ok {
+				return
 			}
+			h.receive(ctx, bm)
+		case <-ctx.Done():
+			return
+		case <-h.quit:
+			return
+		}
+	}
+}
+
+// persistJob is a chat message to save or, if flushed is set, a request to
+// be told once everything queued before it has been saved.
+type persistJob struct {
+	msg     *model.Message
+	flushed chan struct{}
+}
+
+// queuePersist hands a chat message to the persistence worker. If the
+// database has fallen so far behind that the queue is full the message is
+// dropped from history rather than stalling the room.
+func (h *Hub) queuePersist(m *Message, seq int64) {
+	if h.Messages == nil {
+		return
+	}
+
+	h.pending.Add(1)
+	select {
+	case h.persist <- persistJob{msg: &model.Message{
+		Seq:       seq,
+		RoomID:    m.RoomID,
+		UserID:    m.UserID,
+		Username:  m.Username,
+		Content:   m.Content,
+		CreatedAt: time.Now(),
+	}}:
+	default:
+		h.pending.Add(-1)
+		log.Printf("persist queue full, dropping message in room %s", m.RoomID)
+	}
+}
+
+// flushPersist waits until the messages queued to be saved so far have
+// been, so the store has them when it is read.
+func (h *Hub) flushPersist(ctx context.Context) error {
+	flushed := make(chan struct{})
+	select {
+	case h.persist <- persistJob{flushed: flushed}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (h *Hub) persistMessages() {
+	for job := range h.persist {
+		if job.flushed != nil {
+			close(job.flushed)
+			continue
+		}
+		if err := h.Messages.SaveMessage(context.Background(), job.msg); err != nil {
+			log.Printf("failed to save message in room %s: %v", job.msg.RoomID, err)
 		}
+		h.pending.Add(-1)
 	}
 }
@@ -0,0 +1,182 @@
+package websocket
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fanOut is a Hub with rooms full of clients that read as fast as they
+// can, except for every slowEvery'th, which never reads and so exercises
+// the slow consumer policy. There is no network or database.
+type fanOut struct {
+	hub     *Hub
+	rooms   []string
+	fast    int
+	encode  func(*Message) ([]byte, error)
+	stop    func()
+	sent    atomic.Int64
+	written atomic.Int64
+}
+
+func newFanOut(b *testing.B, rooms, clients, slowEvery int, encode func(*Message) ([]byte, error)) *fanOut {
+	b.Helper()
+	hub := NewHub(Options{SlowConsumers: SlowConsumerPolicy{Action: SlowConsumerDrop}})
+	ctx, cancel := context.WithCancel(context.Background())
+	go hub.Run(ctx)
+
+	f := &fanOut{hub: hub, encode: encode}
+	done := make(chan struct{})
+	var readers sync.WaitGroup
+	f.stop = func() {
+		cancel()
+		close(done)
+		readers.Wait()
+	}
+
+	total := 0
+	for r := 0; r < rooms; r++ {
+		roomID := fmt.Sprintf("room-%d", r)
+		f.rooms = append(f.rooms, roomID)
+		for c := 0; c < clients; c++ {
+			cl := &Client{
+				ID:      fmt.Sprintf("user-%d-%d", r, c),
+				RoomID:  roomID,
+				Silent:  true,
+				Message: make(chan *Message, hub.SendBuffer),
+			}
+			hub.Register(cl)
+			total++
+			if slowEvery > 0 && total%slowEvery == 0 {
+				continue
+			}
+
+			f.fast++
+			readers.Add(1)
+			go func() {
+				defer readers.Done()
+				for {
+					select {
+					case m := <-cl.Message:
+						f.read(b, m)
+					case <-done:
+						return
+					}
+				}
+			}()
+		}
+	}
+
+	// Registering is asynchronous, so wait until every shard has seen it.
+	for {
+		n := 0
+		for _, count := range hub.ConnectionCounts() {
+			n += count
+		}
+		if n == total {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return f
+}
+
+func (f *fanOut) read(b *testing.B, m *Message) {
+	if m.Type != MessageTypeChat {
+		return
+	}
+	if f.encode != nil {
+		data, err := f.encode(m)
+		if err != nil {
+			b.Errorf("failed to encode message: %v", err)
+		}
+		f.written.Add(int64(len(data)))
+	}
+	f.sent.Add(1)
+}
+
+// run broadcasts n messages spread over the rooms and waits until the fast
+// clients have them all or deliveries stall, as messages can be dropped on
+// the way when the backplane queue is full. It reports the time and bytes
+// per delivery.
+func (f *fanOut) run(b *testing.B, n int) {
+	perRoom := n / len(f.rooms)
+	want := int64(perRoom * f.fast)
+	b.ResetTimer()
+
+	var wg sync.WaitGroup
+	for _, roomID := range f.rooms {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perRoom; i++ {
+				f.hub.Broadcast(&Message{
+					Type:     MessageTypeChat,
+					RoomID:   roomID,
+					UserID:   "user_2abcdefghijklmnopqrstuvwxyz",
+					Username: "benchmark",
+					Content:  "benchmark message",
+				})
+			}
+		}()
+	}
+	wg.Wait()
+
+	last, progressed := int64(-1), time.Now()
+	for f.sent.Load() < want && time.Since(progressed) < time.Second {
+		if got := f.sent.Load(); got != last {
+			last, progressed = got, time.Now()
+		}
+		time.Sleep(100 * time.Microsecond)
+	}
+	b.StopTimer()
+
+	if got := f.sent.Load(); got > 0 {
+		b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(got), "ns/delivery")
+		if f.encode != nil {
+			b.ReportMetric(float64(f.written.Load())/float64(got), "B/delivery")
+		}
+	}
+}
+
+// BenchmarkFanOut measures how fast the Hub hands messages to clients. An
+// op is one message broadcast to one room.
+func BenchmarkFanOut(b *testing.B) {
+	for _, bc := range []struct {
+		rooms, clients, slowEvery int
+	}{
+		{rooms: 2000, clients: 10},
+		{rooms: 200, clients: 100},
+		{rooms: 2000, clients: 10, slowEvery: 100},
+	} {
+		name := fmt.Sprintf("rooms=%d/clients=%d", bc.rooms, bc.clients)
+		if bc.slowEvery > 0 {
+			name += fmt.Sprintf("/slow=1in%d", bc.slowEvery)
+		}
+		b.Run(name, func(b *testing.B) {
+			f := newFanOut(b, bc.rooms, bc.clients, bc.slowEvery, nil)
+			defer f.stop()
+			f.run(b, max(b.N, bc.rooms))
+		})
+	}
+}
+
+// BenchmarkFanOutEncoded also encodes every delivery as a connection would,
+// either once per message as the Hub does or separately for each client.
+func BenchmarkFanOutEncoded(b *testing.B) {
+	for _, e := range []Encoding{EncodingJSON, EncodingMsgPack} {
+		b.Run(e.String()+"/once", func(b *testing.B) {
+			f := newFanOut(b, 500, 20, 0, func(m *Message) ([]byte, error) { return m.Encode(e) })
+			defer f.stop()
+			f.run(b, max(b.N, 500))
+		})
+		b.Run(e.String()+"/per-client", func(b *testing.B) {
+			f := newFanOut(b, 500, 20, 0, e.Marshal)
+			defer f.stop()
+			f.run(b, max(b.N, 500))
+		})
+	}
+}
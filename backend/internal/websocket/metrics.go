@@ -0,0 +1,37 @@
+package websocket
+
+import (
+	"errors"
+	"expvar"
+	"net"
+)
+
+// metrics are published with expvar under "websocket", so they show up
+// wherever expvar.Handler is served.
+var metrics = struct {
+	connections             *expvar.Int
+	stalePruned             *expvar.Int
+	oversizedMessages       *expvar.Int
+	droppedMessages         *expvar.Int
+	slowConsumerDisconnects *expvar.Int
+}{
+	connections:             new(expvar.Int),
+	stalePruned:             new(expvar.Int),
+	oversizedMessages:       new(expvar.Int),
+	droppedMessages:         new(expvar.Int),
+	slowConsumerDisconnects: new(expvar.Int),
+}
+
+func init() {
+	m := expvar.NewMap("websocket")
+	m.Set("connections", metrics.connections)
+	m.Set("stale_pruned", metrics.stalePruned)
+	m.Set("oversized_messages", metrics.oversizedMessages)
+	m.Set("dropped_messages", metrics.droppedMessages)
+	m.Set("slow_consumer_disconnects", metrics.slowConsumerDisconnects)
+}
+
+func isTimeout(err error) bool {
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
@@ -0,0 +1,128 @@
+package websocket
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+	"unicode"
+
+	"github.com/kamdyns/movie-chat/internal/model"
+)
+
+// ModePatch is a moderator's request to change some of a room's modes.
+// Fields left nil keep their current value.
+type ModePatch struct {
+	SlowModeSeconds *int  `json:"slow_mode_seconds"`
+	MembersOnly     *bool `json:"members_only"`
+	EmojiOnly       *bool `json:"emoji_only"`
+}
+
+// maxSlowModeSeconds bounds slow mode, so a room cannot be silenced for
+// days and the value always fits the database column.
+const maxSlowModeSeconds = 60 * 60
+
+func (p ModePatch) apply(modes model.RoomModes) model.RoomModes {
+	if p.SlowModeSeconds != nil {
+		modes.SlowModeSeconds = *p.SlowModeSeconds
+	}
+	if p.MembersOnly != nil {
+		modes.MembersOnly = *p.MembersOnly
+	}
+	if p.EmojiOnly != nil {
+		modes.EmojiOnly = *p.EmojiOnly
+	}
+	return modes
+}
+
+type modeChange struct {
+	client *Client
+	patch  ModePatch
+}
+
+// checkModes reports why cl may not post content to the room right now, or
+// an empty code if it may. Moderators are exempt from every mode.
+func (r *Room) checkModes(cl *Client, content string, now time.Time) (code, reason string) {
+	if cl.IsModerator {
+		return "", ""
+	}
+
+	if r.Modes.MembersOnly && !cl.IsMember {
+		return ErrorCodeMembersOnly, "Only room members can chat right now"
+	}
+
+	if r.Modes.EmojiOnly && !isEmojiOnly(content) {
+		return ErrorCodeEmojiOnly, "Only emoji are allowed right now"
+	}
+
+	if r.Modes.SlowModeSeconds > 0 {
+		wait := time.Duration(r.Modes.SlowModeSeconds) * time.Second
+		if last, ok := r.lastMessageAt[cl.ID]; ok && now.Sub(last) < wait {
+			remaining := (wait - now.Sub(last)).Round(time.Second)
+			return ErrorCodeSlowMode, fmt.Sprintf("Slow mode is on, you can chat again in %s", remaining)
+		}
+		r.lastMessageAt[cl.ID] = now
+	}
+
+	return "", ""
+}
+
+// changeModes persists a moderator's patch and publishes the new modes,
+// which every instance applies when the event comes back. The modes are
+// saved in another goroutine, so the room carries on meanwhile, and the
+// room keeps its old modes if they cannot be saved.
+func (s *shard) changeModes(mc *modeChange) {
+	r, ok := s.rooms[mc.client.RoomID]
+	if !ok {
+		return
+	}
+
+	modes := mc.patch.apply(r.Modes)
+	if s.hub.Store == nil {
+		s.publishModes(r.ID, mc.client, modes)
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+
+		err := s.hub.Store.UpdateRoomModes(ctx, r.ID, modes)
+		s.post(func() {
+			if err != nil {
+				log.Printf("failed to save modes for room %s: %v", r.ID, err)
+				mc.client.sendError(ErrorCodeInternal, "Failed to change room modes")
+				return
+			}
+			s.publishModes(r.ID, mc.client, modes)
+		})
+	}()
+}
+
+func (s *shard) publishModes(roomID string, by *Client, modes model.RoomModes) {
+	s.publish(roomChannel(roomID), &event{Kind: eventMessage, Message: &Message{
+		Type:     MessageTypeMode,
+		RoomID:   roomID,
+		Username: by.Username,
+		Modes:    &modes,
+	}})
+}
+
+// isEmojiOnly reports whether content is made up only of emoji, including
+// the joiners, variation selectors and skin tone modifiers that build up
+// composite emoji, and whitespace.
+func isEmojiOnly(content string) bool {
+	hasEmoji := false
+	for _, r := range content {
+		switch {
+		case unicode.IsSpace(r):
+		case r == 0x200D, r == 0x20E3, r >= 0xFE00 && r <= 0xFE0F:
+		case r >= 0x1F3FB && r <= 0x1F3FF:
+		case unicode.Is(unicode.So, r):
+			hasEmoji = true
+		default:
+			return false
+		}
+	}
+	return hasEmoji
+}
@@ -0,0 +1,57 @@
+package websocket
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/kamdyns/movie-chat/internal/model"
+)
+
+// slowRooms saves modes once release is closed.
+type slowRooms struct {
+	release chan struct{}
+}
+
+func (s *slowRooms) UpdateRoomModes(ctx context.Context, roomID string, modes model.RoomModes) error {
+	<-s.release
+	return nil
+}
+
+func TestSavingModesDoesNotStallTheShard(t *testing.T) {
+	rooms := &slowRooms{release: make(chan struct{})}
+	hub := NewHub(Options{Rooms: rooms, Shards: 1})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Run(ctx)
+
+	mod := &Client{ID: "user_1", Username: "mod", RoomID: "a", Silent: true, IsModerator: true, Message: make(chan *Message, 8)}
+	hub.Register(mod)
+	other := &Client{ID: "user_2", RoomID: "b", Silent: true, Message: make(chan *Message, 8)}
+	hub.Register(other)
+	waitForClients(t, hub, "a", 1)
+	waitForClients(t, hub, "b", 1)
+
+	on := true
+	mod.requestModeChange(hub, ModePatch{EmojiOnly: &on})
+	hub.Broadcast(&Message{Type: MessageTypeChat, RoomID: "b", UserID: "user_2", Content: "still here"})
+	if m := nextMessage(t, other.Message); m.Content != "still here" {
+		t.Fatalf("got %+v", m)
+	}
+
+	close(rooms.release)
+	if m := nextMessage(t, mod.Message); m.Type != MessageTypeMode || m.Modes == nil || !m.Modes.EmojiOnly {
+		t.Fatalf("got %+v, want the new modes", m)
+	}
+}
+
+func TestSlowModeIsBounded(t *testing.T) {
+	hub := NewHub(Options{})
+	mod := &Client{ID: "user_1", RoomID: "a", IsModerator: true, Message: make(chan *Message, 8)}
+	for _, n := range []int{-1, maxSlowModeSeconds + 1, math.MaxInt} {
+		mod.requestModeChange(hub, ModePatch{SlowModeSeconds: &n})
+		if m := nextMessage(t, mod.Message); m.Type != MessageTypeError || m.Code != ErrorCodeInvalid {
+			t.Fatalf("slow mode of %d: got %+v, want an invalid request error", n, m)
+		}
+	}
+}
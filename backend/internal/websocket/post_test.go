@@ -0,0 +1,128 @@
+package websocket
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kamdyns/movie-chat/internal/backplane"
+	"github.com/kamdyns/movie-chat/internal/filter"
+	"github.com/kamdyns/movie-chat/internal/model"
+)
+
+func newPostHub(t *testing.T, opts Options) *Hub {
+	t.Helper()
+	opts.Filters = filter.NewChain()
+	if opts.Limits == (RateLimits{}) {
+		opts.Limits = RateLimits{ClientRate: 1000, ClientBurst: 1000, RoomRate: 1000, RoomBurst: 1000}
+	}
+	hub := NewHub(opts)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go hub.Run(ctx)
+	return hub
+}
+
+func post(t *testing.T, hub *Hub, cl *Client, content string) *Message {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	m, err := hub.Post(ctx, cl, "", content)
+	if err != nil {
+		t.Fatalf("Post() = %v", err)
+	}
+	return m
+}
+
+func TestPostsShareTheClientRateLimit(t *testing.T) {
+	hub := newPostHub(t, Options{Limits: RateLimits{ClientRate: 0.001, ClientBurst: 1, RoomRate: 1000, RoomBurst: 1000}})
+
+	if m := post(t, hub, &Client{ID: "user_1", RoomID: "r"}, "first"); m.Type != MessageTypeAck {
+		t.Fatalf("got %+v, want an ack", m)
+	}
+	if m := post(t, hub, &Client{ID: "user_1", RoomID: "r"}, "second"); m.Code != ErrorCodeRateLimited {
+		t.Fatalf("got %+v, want %s", m, ErrorCodeRateLimited)
+	}
+	if m := post(t, hub, &Client{ID: "user_2", RoomID: "r"}, "other user"); m.Type != MessageTypeAck {
+		t.Fatalf("got %+v, want an ack for another user", m)
+	}
+}
+
+func TestPostsKeepRoomState(t *testing.T) {
+	// Sequences start at 10, so the first post can be resumed after.
+	seed := func(ctx context.Context, key string) (int64, error) { return 10, nil }
+	hub := newPostHub(t, Options{Backplane: backplane.NewLocal(seed), ReplayBuffer: 16, IdleRoomTimeout: time.Minute})
+	info := &model.Room{Modes: model.RoomModes{SlowModeSeconds: 60}}
+
+	first := post(t, hub, &Client{ID: "user_1", RoomID: "r", RoomInfo: info}, "first")
+	if first.Type != MessageTypeAck {
+		t.Fatalf("got %+v, want an ack", first)
+	}
+	if m := post(t, hub, &Client{ID: "user_1", RoomID: "r", RoomInfo: info}, "too soon"); m.Code != ErrorCodeSlowMode {
+		t.Fatalf("got %+v, want %s", m, ErrorCodeSlowMode)
+	}
+
+	// The room stayed live, so once the post has come back from the
+	// backplane a poll resumes from memory.
+	s := hub.shardFor("r")
+	for delivered := false; !delivered; time.Sleep(time.Millisecond) {
+		s.do(func() { delivered = s.rooms["r"].lastSeq == first.Seq })
+	}
+	cl := &Client{ID: "user_2", RoomID: "r", Silent: true, LastSeq: first.Seq - 1, Message: make(chan *Message, 8)}
+	hub.Register(cl)
+	if m := nextMessage(t, cl.Message); m.Seq != first.Seq || m.Content != "first" {
+		t.Fatalf("got %+v, want the first post", m)
+	}
+}
+
+func TestIdleRoomsAreDropped(t *testing.T) {
+	hub := newPostHub(t, Options{IdleRoomTimeout: 20 * time.Millisecond})
+	cl := &Client{ID: "user_1", RoomID: "r", Silent: true, Message: make(chan *Message, 8)}
+	hub.Register(cl)
+	waitForClients(t, hub, "r", 1)
+	hub.Unregister(cl)
+
+	s := hub.shardFor("r")
+	live := func() (ok bool) {
+		s.do(func() { _, ok = s.rooms["r"] })
+		return ok
+	}
+	if !live() {
+		t.Fatal("room dropped as soon as it emptied")
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for live() {
+		if time.Now().After(deadline) {
+			t.Fatal("idle room was never dropped")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// slowSaves takes a while to save each message.
+type slowSaves struct {
+	memStore
+}
+
+func (s *slowSaves) SaveMessage(ctx context.Context, msg *model.Message) error {
+	time.Sleep(50 * time.Millisecond)
+	return s.memStore.SaveMessage(ctx, msg)
+}
+
+func TestResumeWaitsForPendingSaves(t *testing.T) {
+	store := &slowSaves{}
+	hub := newPostHub(t, Options{Messages: store})
+
+	post(t, hub, &Client{ID: "user_1", RoomID: "r"}, "first")
+	second := post(t, hub, &Client{ID: "user_1", RoomID: "r"}, "second")
+	waitForClients(t, hub, "r", 0)
+
+	// The room is gone and the second message is not saved yet, so it has
+	// to come from the store.
+	cl := &Client{ID: "user_2", RoomID: "r", Silent: true, LastSeq: second.Seq - 1, Message: make(chan *Message, 8)}
+	hub.Register(cl)
+	if m := nextMessage(t, cl.Message); m.Seq != second.Seq || m.Content != "second" {
+		t.Fatalf("got %+v, want the second post", m)
+	}
+}
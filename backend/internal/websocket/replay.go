@@ -0,0 +1,164 @@
+package websocket
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// replayLog keeps a room's latest chat messages, in sequence order, so
+// clients that reconnect can be sent what they missed without a query.
+type replayLog struct {
+	buf   []*Message
+	start int
+	n     int
+}
+
+func newReplayLog(size int) *replayLog {
+	return &replayLog{buf: make([]*Message, size)}
+}
+
+func (l *replayLog) add(m *Message) {
+	if len(l.buf) == 0 {
+		return
+	}
+	if l.n < len(l.buf) {
+		l.buf[(l.start+l.n)%len(l.buf)] = m
+		l.n++
+		return
+	}
+	l.buf[l.start] = m
+	l.start = (l.start + 1) % len(l.buf)
+}
+
+func (l *replayLog) at(i int) *Message {
+	return l.buf[(l.start+i)%len(l.buf)]
+}
+
+// since returns the messages numbered after seq. It reports false if the
+// log does not reach back that far.
+func (l *replayLog) since(seq int64) ([]*Message, bool) {
+	if l.n == 0 || l.at(0).Seq > seq+1 {
+		return nil, false
+	}
+
+	var missed []*Message
+	for i := 0; i < l.n; i++ {
+		if m := l.at(i); m.Seq > seq {
+			missed = append(missed, m)
+		}
+	}
+	return missed, true
+}
+
+// resume sends a reconnecting client the chat messages it missed, from the
+// room's replay log or, when that does not reach back far enough, from the
+// message store. The store is read in another goroutine, and live messages
+// for the client are held back until it has been answered. Replay is capped
+// at half the client's buffer so live messages still fit; a client that
+// missed more is told to reload history over the REST API instead.
+func (s *shard) resume(r *Room, cl *Client) {
+	if cl.LastSeq >= r.lastSeq && r.lastSeq > 0 {
+		return
+	}
+
+	if missed, ok := r.replay.since(cl.LastSeq); ok || s.hub.Messages == nil {
+		s.replay(r, cl, missed, ok)
+		return
+	}
+
+	roomID, seq, limit := r.ID, cl.LastSeq, cap(cl.Message)/2+1
+	cl.resuming = true
+	go func() {
+		stored, err := s.hub.loadMissed(roomID, seq, limit)
+		s.post(func() { s.resumeFromStore(r, cl, stored, err) })
+	}()
+}
+
+// resumeFromStore finishes resuming cl with the messages read from the
+// store, followed by any in the replay log that are too new to have been
+// stored yet, then the live messages held back meanwhile. If more arrived
+// than it could hold, it is told to resync instead.
+func (s *shard) resumeFromStore(r *Room, cl *Client, stored []*Message, err error) {
+	held, overflowed := cl.held, cl.overflowed
+	cl.resuming, cl.held, cl.overflowed = false, nil, false
+	if s.rooms[r.ID] != r || !r.Clients[cl] {
+		return
+	}
+
+	if err != nil {
+		log.Printf("failed to load missed messages in room %s: %v", r.ID, err)
+	}
+	missed, ok := stored, err == nil
+	if ok {
+		seq := cl.LastSeq
+		if len(stored) > 0 {
+			seq = stored[len(stored)-1].Seq
+		}
+		if recent, found := r.replay.since(seq); found {
+			missed = append(missed, recent...)
+		}
+	}
+	s.replay(r, cl, missed, ok && !overflowed)
+	if overflowed {
+		return
+	}
+
+	for _, m := range held {
+		if m.Seq > 0 && m.Seq <= cl.resumedThrough {
+			continue
+		}
+		s.send(cl, m)
+	}
+}
+
+// replay sends cl the messages it missed, or tells it to resync if they
+// could not be found or are too many.
+func (s *shard) replay(r *Room, cl *Client, missed []*Message, ok bool) {
+	if !ok || len(missed) > cap(cl.Message)/2 {
+		s.send(cl, &Message{
+			Type:    MessageTypeResync,
+			Content: "Too many messages were missed, reload the history",
+			RoomID:  r.ID,
+			Seq:     r.lastSeq,
+		})
+		return
+	}
+
+	for _, m := range missed {
+		cl.resumedThrough = m.Seq
+		if cl.Blocked[m.UserID] {
+			continue
+		}
+		s.send(cl, m)
+	}
+}
+
+// loadMissed reads up to limit messages numbered after seq from the store,
+// once the messages still queued to be saved are. It runs outside the
+// shards, as the store may be slow.
+func (h *Hub) loadMissed(roomID string, seq int64, limit int) ([]*Message, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if err := h.flushPersist(ctx); err != nil {
+		return nil, err
+	}
+	stored, err := h.Messages.MessagesAfter(ctx, roomID, seq, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	missed := make([]*Message, 0, len(stored))
+	for _, m := range stored {
+		missed = append(missed, &Message{
+			Type:     MessageTypeChat,
+			Content:  m.Content,
+			RoomID:   m.RoomID,
+			UserID:   m.UserID,
+			Username: m.Username,
+			Seq:      m.Seq,
+		})
+	}
+	return missed, nil
+}
@@ -0,0 +1,68 @@
+package websocket
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kamdyns/movie-chat/internal/backplane"
+	"github.com/kamdyns/movie-chat/internal/model"
+)
+
+// slowStore answers MessagesAfter with stored once release is closed, and
+// saves nothing.
+type slowStore struct {
+	stored  []model.Message
+	release chan struct{}
+}
+
+func (s *slowStore) SaveMessage(ctx context.Context, msg *model.Message) error {
+	return nil
+}
+
+func (s *slowStore) MessagesAfter(ctx context.Context, roomID string, afterSeq int64, limit int) ([]model.Message, error) {
+	<-s.release
+	var after []model.Message
+	for _, m := range s.stored {
+		if m.Seq > afterSeq && len(after) < limit {
+			after = append(after, m)
+		}
+	}
+	return after, nil
+}
+
+func TestResumeFromStoreHoldsLiveMessages(t *testing.T) {
+	store := &slowStore{release: make(chan struct{})}
+	for seq := int64(1); seq <= 5; seq++ {
+		store.stored = append(store.stored, model.Message{Seq: seq, RoomID: "r", UserID: "user_1", Content: "stored"})
+	}
+	seed := func(ctx context.Context, key string) (int64, error) { return 5, nil }
+	hub := NewHub(Options{Backplane: backplane.NewLocal(seed), Messages: store, Shards: 1})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Run(ctx)
+
+	other := &Client{ID: "user_1", RoomID: "r", Silent: true, Message: make(chan *Message, 8)}
+	hub.Register(other)
+	waitForClients(t, hub, "r", 1)
+	resumer := &Client{ID: "user_2", RoomID: "r", Silent: true, LastSeq: 2, Message: make(chan *Message, 8)}
+	hub.Register(resumer)
+	waitForClients(t, hub, "r", 2)
+
+	// The store is still being read, but the room carries on.
+	hub.Broadcast(&Message{Type: MessageTypeChat, RoomID: "r", UserID: "user_1", Content: "live"})
+	if m := nextMessage(t, other.Message); m.Seq != 6 || m.Content != "live" {
+		t.Fatalf("got %+v, want the live message", m)
+	}
+	select {
+	case m := <-resumer.Message:
+		t.Fatalf("got %+v before the missed messages", m)
+	default:
+	}
+
+	close(store.release)
+	for want := int64(3); want <= 6; want++ {
+		if m := nextMessage(t, resumer.Message); m.Seq != want {
+			t.Fatalf("got %+v, want seq %d", m, want)
+		}
+	}
+}
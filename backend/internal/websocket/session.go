@@ -0,0 +1,122 @@
+package websocket
+
+import (
+	"context"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Close codes in the private range tell clients why the server dropped
+// them. After CloseSessionExpired clients should get a new ticket and
+// reconnect, and after CloseSlowConsumer they may reconnect; the others are
+// final.
+const (
+	CloseSessionExpired = 4001
+	CloseRoomClosed     = 4002
+	CloseSuspended      = 4003
+	CloseSlowConsumer   = 4004
+	CloseAccountDeleted = 4005
+)
+
+// watchExpiry closes the connection grace after its session expires.
+// Clients keep the connection alive by sending a fresh token in an
+// authenticate message before then. Connections without an expiry never
+// expire.
+func (c *Connection) watchExpiry(grace time.Duration) {
+	c.expiryGrace = grace
+	if c.ExpiresAt.IsZero() {
+		return
+	}
+	c.expiry = time.AfterFunc(c.untilExpiry(c.ExpiresAt), func() {
+		c.closeWith(CloseSessionExpired, "Session expired")
+	})
+}
+
+// untilExpiry is how long a connection authenticated until expiresAt may
+// stay open.
+func (c *Connection) untilExpiry(expiresAt time.Time) time.Duration {
+	return time.Until(expiresAt) + c.expiryGrace
+}
+
+func (c *Connection) stopExpiry() {
+	if c.expiry != nil {
+		c.expiry.Stop()
+	}
+}
+
+// reauthenticate verifies a refreshed token for the same user and pushes
+// the connection's expiry out to match it. Tokens without an expiry are
+// refused, as they would keep the connection open forever.
+func (c *Connection) reauthenticate(hub *Hub, token string) {
+	if hub.Auth == nil || c.expiry == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	identity, err := hub.Auth.Authenticate(ctx, token)
+	if err != nil {
+		c.sendError("", ErrorCodeUnauthorized, "Invalid session token")
+		return
+	}
+	if identity.UserID != c.UserID {
+		c.sendError("", ErrorCodeForbidden, "Token belongs to a different user")
+		return
+	}
+
+	if identity.ExpiresAt.IsZero() {
+		c.sendError("", ErrorCodeUnauthorized, "Session token has no expiry")
+		return
+	}
+	c.expiry.Reset(c.untilExpiry(identity.ExpiresAt))
+}
+
+// closeWith drops the connection, telling the peer why. Closing the
+// underlying connection ends the read loop, which unregisters its clients.
+func (c *Connection) closeWith(code int, reason string) {
+	c.mu.Lock()
+	if c.closeCode == 0 {
+		c.closeCode, c.closeReason = code, reason
+	}
+	c.mu.Unlock()
+
+	if c.Conn != nil {
+		msg := websocket.FormatCloseMessage(code, reason)
+		c.Conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(c.writeWait))
+	}
+	c.close()
+}
+
+// EndSession closes every connection opened with sessionID, so signing out
+// or revoking a session elsewhere also ends its chats.
+func (h *Hub) EndSession(sessionID string) {
+	h.publish(hubChannel, &event{Kind: eventDisconnect, Disconnect: &disconnect{SessionID: sessionID, Code: CloseSessionExpired, Reason: "Session ended"}})
+}
+
+// disconnect closes every connection of UserID, or every connection opened
+// with SessionID, in any room.
+type disconnect struct {
+	UserID    string `json:"user_id,omitempty"`
+	SessionID string `json:"session_id,omitempty"`
+	Code      int    `json:"code"`
+	Reason    string `json:"reason"`
+}
+
+func (d *disconnect) matches(cl *Client) bool {
+	if d.UserID != "" {
+		return cl.ID == d.UserID
+	}
+	return d.SessionID != "" && cl.SessionID == d.SessionID
+}
+
+func (s *shard) disconnect(d *disconnect) {
+	for _, r := range s.rooms {
+		for cl := range r.Clients {
+			if d.matches(cl) {
+				go cl.closeWith(d.Code, d.Reason)
+			}
+		}
+	}
+}
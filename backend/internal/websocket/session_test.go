@@ -0,0 +1,95 @@
+package websocket
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kamdyns/movie-chat/internal/auth"
+)
+
+type stubAuthenticator struct {
+	identity *auth.Identity
+}
+
+func (a stubAuthenticator) Authenticate(ctx context.Context, token string) (*auth.Identity, error) {
+	return a.identity, nil
+}
+
+func openConnection(t *testing.T, hub *Hub, expiresAt time.Time) *Connection {
+	t.Helper()
+	c := &Connection{Message: make(chan *Message, 8), UserID: "user_1", ExpiresAt: expiresAt}
+	if !c.Open(hub) {
+		t.Fatal("Open() failed")
+	}
+	t.Cleanup(func() { c.Close(hub) })
+	return c
+}
+
+func closedWithin(c *Connection, d time.Duration) bool {
+	select {
+	case <-c.Done():
+		return true
+	case <-time.After(d):
+		return false
+	}
+}
+
+func TestConnectionsCloseWhenTheSessionExpires(t *testing.T) {
+	hub := NewHub(Options{})
+	c := openConnection(t, hub, time.Now().Add(100*time.Millisecond))
+
+	if closedWithin(c, 50*time.Millisecond) {
+		t.Fatal("connection closed before its session expired")
+	}
+	if !closedWithin(c, time.Second) {
+		t.Fatal("connection stayed open after its session expired")
+	}
+	if code, _ := c.CloseReason(); code != CloseSessionExpired {
+		t.Fatalf("closed with %d, want %d", code, CloseSessionExpired)
+	}
+}
+
+func TestExpiredConnectionsGetAGracePeriod(t *testing.T) {
+	hub := NewHub(Options{ExpiryGrace: 200 * time.Millisecond})
+	c := openConnection(t, hub, time.Now().Add(time.Millisecond))
+
+	if closedWithin(c, 100*time.Millisecond) {
+		t.Fatal("connection closed before the grace period ended")
+	}
+	if !closedWithin(c, time.Second) {
+		t.Fatal("connection stayed open after the grace period")
+	}
+}
+
+func TestReauthenticateExtendsTheSession(t *testing.T) {
+	hub := NewHub(Options{Auth: stubAuthenticator{identity: &auth.Identity{UserID: "user_1", ExpiresAt: time.Now().Add(time.Hour)}}})
+	c := openConnection(t, hub, time.Now().Add(50*time.Millisecond))
+
+	c.reauthenticate(hub, "token")
+	if closedWithin(c, 200*time.Millisecond) {
+		t.Fatal("connection closed at the old expiry")
+	}
+}
+
+func TestReauthenticateRefusesTokensWithoutExpiry(t *testing.T) {
+	hub := NewHub(Options{Auth: stubAuthenticator{identity: &auth.Identity{UserID: "user_1"}}})
+	c := openConnection(t, hub, time.Now().Add(100*time.Millisecond))
+
+	c.reauthenticate(hub, "token")
+	if m := nextMessage(t, c.Message); m.Type != MessageTypeError || m.Code != ErrorCodeUnauthorized {
+		t.Fatalf("got %+v, want an unauthorized error", m)
+	}
+	if !closedWithin(c, time.Second) {
+		t.Fatal("a token without expiry kept the connection open")
+	}
+}
+
+func TestConnectionsWithoutExpiryStayOpen(t *testing.T) {
+	hub := NewHub(Options{})
+	c := openConnection(t, hub, time.Time{})
+
+	if closedWithin(c, 50*time.Millisecond) {
+		t.Fatal("connection without expiry was closed")
+	}
+}
@@ -0,0 +1,344 @@
+package websocket
+
+import (
+	"log"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/kamdyns/movie-chat/internal/model"
+)
+
+// shard owns a subset of the Hub's rooms. Only its goroutine touches those
+// rooms and their clients' Blocked maps, so none of it needs locking.
+type shard struct {
+	hub   *Hub
+	rooms map[string]*Room
+
+	register    chan *Client
+	unregister  chan *Client
+	broadcast   chan *Message
+	events      chan *event
+	modeChanges chan *modeChange
+	// tasks runs rare requests, such as counting connections, that would
+	// otherwise need a channel each.
+	tasks chan func()
+	// subscriptions holds, for each room channel being subscribed to or
+	// unsubscribed from, the change in progress followed by any waiting
+	// for it.
+	subscriptions map[string][]*subscription
+	// draining is set once the Hub is shutting down.
+	draining bool
+}
+
+func newShard(h *Hub) *shard {
+	return &shard{
+		hub:         h,
+		rooms:       make(map[string]*Room),
+		register:    make(chan *Client, 64),
+		unregister:  make(chan *Client, 64),
+		broadcast:   make(chan *Message, 256),
+		events:      make(chan *event, 256),
+		modeChanges: make(chan *modeChange),
+		tasks:       make(chan func()),
+
+		subscriptions: make(map[string][]*subscription),
+	}
+}
+
+// run handles the shard's rooms until the Hub stops, then disconnects
+// their clients.
+func (s *shard) run() {
+	for {
+		select {
+		case cl := <-s.register:
+			s.join(cl)
+		case cl := <-s.unregister:
+			s.leave(cl)
+		case m := <-s.broadcast:
+			s.accept(m)
+		case ev := <-s.events:
+			s.apply(ev)
+		case mc := <-s.modeChanges:
+			s.changeModes(mc)
+		case task := <-s.tasks:
+			task()
+		case <-s.hub.done:
+			for _, r := range s.rooms {
+				for cl := range r.Clients {
+					go cl.closeWith(websocket.CloseGoingAway, "Server shutting down")
+				}
+			}
+			return
+		}
+	}
+}
+
+// do runs f on the shard's goroutine and waits for it, unless the Hub has
+// stopped.
+func (s *shard) do(f func()) {
+	done := make(chan struct{})
+	select {
+	case s.tasks <- func() { f(); close(done) }:
+		<-done
+	case <-s.hub.done:
+	}
+}
+
+func (s *shard) join(cl *Client) {
+	r, ok := s.rooms[cl.RoomID]
+	if !ok {
+		r = s.openRoom(cl.RoomID, cl.RoomInfo)
+	}
+
+	r.Clients[cl] = true
+	cl.resumedThrough = cl.LastSeq
+	if !r.subscribed {
+		r.waiting = append(r.waiting, cl)
+		return
+	}
+	s.welcome(r, cl)
+}
+
+// openRoom makes a room live on this instance and subscribes to it.
+func (s *shard) openRoom(roomID string, info *model.Room) *Room {
+	r := newRoom(roomID, info, s.hub.ReplayBuffer)
+	s.rooms[roomID] = r
+	s.changeSubscription(&subscription{channel: roomChannel(roomID), done: func(error) { s.subscribed(r) }})
+	return r
+}
+
+// subscribed welcomes the clients waiting for r, unless r was dropped in
+// the meantime, then accepts the messages posted to it meanwhile. A room
+// whose channel could not be subscribed to is treated as subscribed, so its
+// clients at least see each other on this instance.
+func (s *shard) subscribed(r *Room) {
+	deferred := r.deferred
+	r.deferred = nil
+	if s.rooms[r.ID] == r {
+		r.subscribed = true
+		waiting := r.waiting
+		r.waiting = nil
+		for _, cl := range waiting {
+			if r.Clients[cl] {
+				s.welcome(r, cl)
+			}
+		}
+	}
+
+	for _, m := range deferred {
+		s.accept(m)
+	}
+}
+
+// welcome sends cl what it missed and tells the room it joined.
+func (s *shard) welcome(r *Room, cl *Client) {
+	if cl.LastSeq > 0 {
+		s.resume(r, cl)
+	}
+	if !cl.Silent {
+		s.publishPresence(cl, MessageTypeJoin)
+	}
+	if s.draining {
+		s.restart(cl)
+	}
+}
+
+// leave removes cl from its room. The room may already be gone, if it was
+// closed, or cl may have been removed before, so both are checked. A client
+// that leaves before it was welcomed leaves without the room being told.
+func (s *shard) leave(cl *Client) {
+	r, ok := s.rooms[cl.RoomID]
+	if !ok || !r.Clients[cl] {
+		return
+	}
+
+	delete(r.Clients, cl)
+	if !cl.Silent && r.subscribed {
+		s.publishPresence(cl, MessageTypeLeave)
+	}
+	if len(r.Clients) == 0 {
+		s.idle(r)
+	}
+}
+
+// idle drops r, which has no clients left, once it has stayed that way for
+// the Hub's IdleRoomTimeout. Calling it again restarts the wait.
+func (s *shard) idle(r *Room) {
+	if s.hub.IdleRoomTimeout <= 0 {
+		s.dropRoom(r.ID)
+		return
+	}
+
+	r.emptied++
+	emptied := r.emptied
+	time.AfterFunc(s.hub.IdleRoomTimeout, func() {
+		s.post(func() {
+			if s.rooms[r.ID] == r && len(r.Clients) == 0 && r.emptied == emptied {
+				s.dropRoom(r.ID)
+			}
+		})
+	})
+}
+
+// accept checks a message for its room and publishes it. Messages from a
+// client are checked against the room's modes here, on the client's own
+// instance. A client posting to a room with nobody here, such as over
+// HTTP, makes the room live, so its slow mode and sequence carry over to
+// later posts until it has been idle for a while. Chat messages are
+// numbered as they are published, then persisted once and acked to their
+// sender. Messages for a room still being subscribed to wait until it is.
+func (s *shard) accept(m *Message) {
+	r, ok := s.rooms[m.RoomID]
+	if !ok && m.sender != nil {
+		r, ok = s.openRoom(m.RoomID, m.sender.RoomInfo), true
+	}
+	if ok && !r.subscribed {
+		r.deferred = append(r.deferred, m)
+		return
+	}
+	if ok && len(r.Clients) == 0 {
+		defer s.idle(r)
+	}
+
+	if m.sender != nil {
+		if code, reason := r.checkModes(m.sender, m.Content, time.Now()); code != "" {
+			m.sender.reject(m.ClientID, code, reason)
+			return
+		}
+	}
+
+	if m.Type != MessageTypeChat {
+		s.publish(roomChannel(m.RoomID), &event{Kind: eventMessage, Message: m})
+		return
+	}
+
+	o, ok := encodeEvent(roomChannel(m.RoomID), &event{Kind: eventMessage, Message: m})
+	if !ok {
+		return
+	}
+	o.sequence = m.RoomID
+	o.published = func(seq int64, err error) {
+		if err != nil {
+			if m.sender != nil {
+				m.sender.reject(m.ClientID, ErrorCodeInternal, "Message could not be sent")
+			}
+			return
+		}
+		s.hub.queuePersist(m, seq)
+		if m.sender != nil {
+			m.sender.ack(m.ClientID, seq)
+		}
+	}
+	s.queue(o)
+}
+
+// apply acts on an event from the backplane.
+func (s *shard) apply(ev *event) {
+	switch ev.Kind {
+	case eventMessage:
+		s.deliver(ev.Message)
+	case eventClose:
+		s.closeRoom(ev.Close)
+	case eventDisconnect:
+		s.disconnect(ev.Disconnect)
+	case eventBlock:
+		s.changeBlock(ev.Block)
+	case eventResult:
+		ev.result()
+	}
+}
+
+// deliver hands a message to the room's clients on this instance.
+func (s *shard) deliver(m *Message) {
+	r, ok := s.rooms[m.RoomID]
+	if !ok {
+		return
+	}
+
+	if m.Type == MessageTypeMode && m.Modes != nil {
+		r.Modes = *m.Modes
+		if r.Modes.SlowModeSeconds == 0 {
+			r.lastMessageAt = make(map[string]time.Time)
+		}
+	}
+	if m.Seq > 0 {
+		r.lastSeq = m.Seq
+		r.replay.add(m)
+	}
+
+	for cl := range r.Clients {
+		if cl.Blocked[m.UserID] || m.Seq > 0 && m.Seq <= cl.resumedThrough {
+			continue
+		}
+		if cl.resuming {
+			s.hold(cl, m)
+			continue
+		}
+		s.send(cl, m)
+	}
+}
+
+// hold keeps m for a client that is resuming, until it has been sent what
+// it missed.
+func (s *shard) hold(cl *Client, m *Message) {
+	if len(cl.held) >= cap(cl.Message) {
+		cl.overflowed = true
+		metrics.droppedMessages.Add(1)
+		return
+	}
+	cl.held = append(cl.held, m)
+}
+
+// send queues m for cl without waiting. A client that cannot keep up is
+// dealt with by the Hub's SlowConsumers policy.
+func (s *shard) send(cl *Client, m *Message) {
+	select {
+	case cl.Message <- m:
+		cl.dropped = 0
+		return
+	default:
+	}
+
+	metrics.droppedMessages.Add(1)
+	if cl.closing {
+		return
+	}
+	cl.dropped++
+
+	policy := s.hub.SlowConsumers
+	if policy.Action != SlowConsumerDisconnect && (policy.MaxDropped <= 0 || cl.dropped < policy.MaxDropped) {
+		return
+	}
+
+	log.Printf("disconnecting slow client %s in room %s after %d dropped messages", cl.ID, cl.RoomID, cl.dropped)
+	cl.closing = true
+	metrics.slowConsumerDisconnects.Add(1)
+	// Writing the close frame can take up to its deadline, which the
+	// shard should not wait for.
+	go cl.closeWith(CloseSlowConsumer, "Too slow to keep up")
+}
+
+func (s *shard) changeBlock(bc *blockChange) {
+	for _, r := range s.rooms {
+		for cl := range r.Clients {
+			if cl.ID != bc.UserID {
+				continue
+			}
+			if cl.Blocked == nil {
+				cl.Blocked = make(map[string]bool)
+			}
+			if bc.Blocked {
+				cl.Blocked[bc.TargetID] = true
+			} else {
+				delete(cl.Blocked, bc.TargetID)
+			}
+		}
+	}
+}
+
+// dropRoom forgets a room with no local clients left. Its modes are
+// persisted, so they are loaded again when someone rejoins.
+func (s *shard) dropRoom(roomID string) {
+	delete(s.rooms, roomID)
+	s.changeSubscription(&subscription{channel: roomChannel(roomID), unsubscribe: true})
+}
@@ -0,0 +1,102 @@
+package websocket
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Shutdown drains the Hub for a restart. Every client is told to reconnect,
+// after a random delay of up to ReconnectJitter so they do not all arrive
+// at once, and closed with status 1012. Once they have gone the Hub stops,
+// and Shutdown waits for queued messages to be published and saved before
+// closing the backplane. If ctx expires first, whatever is left is dropped
+// and ctx's error is returned.
+func (h *Hub) Shutdown(ctx context.Context) error {
+	for _, s := range h.shards {
+		s.do(s.drain)
+	}
+
+	if err := waitFor(ctx, func() bool { return h.clients.Load() == 0 }); err != nil {
+		err = fmt.Errorf("%d clients still connected: %w", h.clients.Load(), err)
+		h.stop()
+		return err
+	}
+
+	h.stop()
+	select {
+	case <-h.stopped:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if err := waitFor(ctx, func() bool { return h.pending.Load() == 0 }); err != nil {
+		return fmt.Errorf("%d messages not published or saved: %w", h.pending.Load(), err)
+	}
+	return h.Backplane.Close()
+}
+
+// stop makes Run return, which disconnects any clients left.
+func (h *Hub) stop() {
+	h.stopOnce.Do(func() { close(h.quit) })
+}
+
+// drain asks the shard's clients to reconnect, and any that join from now
+// on straight away.
+func (s *shard) drain() {
+	s.draining = true
+	for _, r := range s.rooms {
+		for cl := range r.Clients {
+			s.restart(cl)
+		}
+	}
+}
+
+// restart queues the restart notice behind the messages already queued for
+// cl's connection, once per connection however many rooms it is in. The
+// writer closes the connection once it has sent it. A connection with no
+// room left in its buffer is closed without one.
+func (s *shard) restart(cl *Client) {
+	if cl.conn == nil {
+		return
+	}
+
+	cl.conn.restartOnce.Do(func() {
+		notice := &Message{
+			Type:       MessageTypeRestart,
+			Content:    "Server restarting, reconnect",
+			RetryAfter: s.hub.retryHint().Milliseconds(),
+		}
+
+		select {
+		case cl.Message <- notice:
+		default:
+			go cl.closeWith(websocket.CloseServiceRestart, "Server restarting")
+		}
+	})
+}
+
+func (h *Hub) retryHint() time.Duration {
+	if h.ReconnectJitter <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(h.ReconnectJitter)))
+}
+
+// waitFor polls done until it reports true or ctx expires.
+func waitFor(ctx context.Context, done func() bool) error {
+	tick := time.NewTicker(10 * time.Millisecond)
+	defer tick.Stop()
+
+	for !done() {
+		select {
+		case <-tick.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
@@ -7,18 +7,21 @@ import (
 	_ "github.com/lib/pq"
 )
 
-func NewDatabase() (*sql.DB, error) {
+// ConnString is the connection string NewDatabase connects with.
+func ConnString() string {
 	host := "localhost" // Use "movie-chat-postgres" if your Go app is also in a Docker container
 	port := 5433
 	user := "postgres"
 	password := "password"
 	dbname := "go-chat"
 
-	psqlInfo := fmt.Sprintf("host=%s port=%d user=%s "+
+	return fmt.Sprintf("host=%s port=%d user=%s "+
 		"password=%s dbname=%s sslmode=disable",
 		host, port, user, password, dbname)
+}
 
-	db, err := sql.Open("postgres", psqlInfo)
+func NewDatabase() (*sql.DB, error) {
+	db, err := sql.Open("postgres", ConnString())
 	if err != nil {
 		return nil, err
 	}